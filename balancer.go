@@ -0,0 +1,128 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	BalancerRoundRobin = `roundRobin`
+	BalancerWeighted   = `weighted`
+	BalancerRandom     = `random`
+	BalancerLeastInUse = `leastInUse`
+)
+
+var (
+	ErrUnknownBalancer = errors.New("mysql group: unknown balancer")
+)
+
+var (
+	balancerMutex sync.RWMutex
+	balancers     = map[string]func() Balancer{
+		BalancerRoundRobin: func() Balancer { return &roundRobin{} },
+		BalancerWeighted:   func() Balancer { return weighted{} },
+		BalancerRandom:     func() Balancer { return random{} },
+		BalancerLeastInUse: func() Balancer { return &leastInUse{} },
+	}
+)
+
+// Node 可选的连接池
+type Node struct {
+	Index  int
+	Weight int
+	Pool   Pool
+}
+
+// Balancer 负载均衡策略，返回选中节点在nodes中的位置，nodes至少有一个元素
+type Balancer interface {
+	Select(nodes []Node) int
+}
+
+// RegisterBalancer 注册负载均衡策略，注册后可在GroupOption.Balancer中按name选择
+func RegisterBalancer(name string, factory func() Balancer) {
+	balancerMutex.Lock()
+	defer balancerMutex.Unlock()
+
+	balancers[name] = factory
+}
+
+// newBalancer 实例化负载均衡策略，name为空时使用roundRobin
+func newBalancer(name string) (Balancer, error) {
+	if name == "" {
+		name = BalancerRoundRobin
+	}
+
+	balancerMutex.RLock()
+	factory, exists := balancers[name]
+	balancerMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w %q", ErrUnknownBalancer, name)
+	}
+	return factory(), nil
+}
+
+type roundRobin struct {
+	counter atomic.Uint64
+}
+
+func (rr *roundRobin) Select(nodes []Node) int {
+	return int((rr.counter.Inc() - 1) % uint64(len(nodes)))
+}
+
+type weighted struct{}
+
+func (w weighted) Select(nodes []Node) int {
+	total := 0
+	for _, node := range nodes {
+		total += node.Weight
+	}
+
+	if total < 1 {
+		return rand.Intn(len(nodes))
+	}
+
+	offset := rand.Intn(total)
+	for index, node := range nodes {
+		if offset < node.Weight {
+			return index
+		}
+		offset -= node.Weight
+	}
+
+	return len(nodes) - 1
+}
+
+type random struct{}
+
+func (r random) Select(nodes []Node) int {
+	return rand.Intn(len(nodes))
+}
+
+type leastInUse struct {
+	counter atomic.Uint64
+}
+
+// Select 选择使用中连接数最少的节点，数量相同时轮询
+func (liu *leastInUse) Select(nodes []Node) int {
+	var (
+		start    = int(liu.counter.Inc() % uint64(len(nodes)))
+		selected = start
+		minInUse = -1
+	)
+
+	for offset := 0; offset < len(nodes); offset++ {
+		index := (start + offset) % len(nodes)
+		inUse := nodes[index].Pool.Stats().InUse
+		if minInUse < 0 || inUse < minInUse {
+			minInUse = inUse
+			selected = index
+		}
+	}
+
+	return selected
+}
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"database/sql"
 	"errors"
 	"reflect"
 	"strings"
@@ -24,7 +25,7 @@ var (
 	ErrNotFoundField        = errors.New(`failed to match the field from the struct to the database. Please configure the borm tag correctly`)
 	ErrNotFoundPrimaryField = errors.New(`failed to found primary field. Please configure the primary on borm tag correctly`)
 	ErrInvalidTypes         = errors.New(`only *struct types are supported`)
-	ErrInvalidFieldTypes    = errors.New(`only bool(1 is true, other is false),string、float64、float32、int、uint、int8、uint8、int16、uint16、int32、uint32、int64 and uint64 types are supported`)
+	ErrInvalidFieldTypes    = errors.New(`only bool(1 is true, other is false),string、float64、float32、int、uint、int8、uint8、int16、uint16、int32、uint32、int64、uint64、[]byte、time.Time, pointers to them and sql.Scanner types are supported`)
 )
 
 func tableName(value reflect.Value) (tableName string) {
@@ -56,7 +57,7 @@ func SqlFindOneObj(args *[]interface{}, where Where, obj interface{}) (sql strin
 	)
 
 	sqlBuffer.WriteString("SELECT * FROM `")
-	sqlBuffer.WriteString(tableName(value))
+	sqlBuffer.WriteString(getModelMeta(value.Type()).table)
 	sqlBuffer.WriteByte('`')
 
 	if where != nil {
@@ -69,107 +70,70 @@ func SqlFindOneObj(args *[]interface{}, where Where, obj interface{}) (sql strin
 
 // SqlInsertObjs ---
 func SqlInsertObjs(args *[]interface{}, rows interface{}) (sql string, err error) {
-	var (
-		vRows  = reflect.ValueOf(rows)
-		values []reflect.Value
-	)
-
-	switch vRows.Kind() {
-	case reflect.Slice:
-		values = make([]reflect.Value, 0, vRows.Len())
-		for i := 0; i < vRows.Len(); i++ {
-			value := vRows.Index(i)
-
-			if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
-				return "", ErrInvalidRowsTypes
-			}
-
-			if bs := value.MethodByName(beforeSave); bs.Kind() == reflect.Func {
-				bs.Call(nil)
-			}
+	sql, _, err = sqlInsertObjs(args, insertInto, rows)
+	return
+}
 
-			if bc := value.MethodByName(beforeCreate); bc.Kind() == reflect.Func {
-				bc.Call(nil)
-			}
-			values = append(values, value.Elem())
-		}
-	case reflect.Ptr:
-		if vRows.Elem().Kind() != reflect.Struct {
-			return "", ErrInvalidRowsTypes
-		}
+// sqlInsertObjs 生成对象插入sql，同时返回插入的非主键字段
+func sqlInsertObjs(args *[]interface{}, verb string, rows interface{}) (sql string, updateFields []string, err error) {
+	values, err := objValues(rows)
+	if err != nil {
+		return "", nil, err
+	}
 
-		if bs := vRows.MethodByName(beforeSave); bs.Kind() == reflect.Func {
-			bs.Call(nil)
-		}
+	var (
+		meta = getModelMeta(values[0].Elem().Type())
+	)
 
-		if bc := vRows.MethodByName(beforeCreate); bc.Kind() == reflect.Func {
-			bc.Call(nil)
-		}
-		values = []reflect.Value{vRows.Elem()}
-	default:
-		return "", ErrInvalidRowsTypes
+	for index, value := range values {
+		callHook(value, meta.beforeSave)
+		callHook(value, meta.beforeCreate)
+		values[index] = value.Elem()
 	}
 
 	var (
 		sqlBuffer    strings.Builder
 		dbFieldCount int
-		dbField      string
-		isRequired   bool
 
 		value       = values[0]
-		t           = value.Type()
-		fieldCount  = t.NumField()
-		dbFieldList = make([]string, 0, len(values))
-		v           = make([]byte, 0, 2*fieldCount)
+		dbFieldList = make([]int, 0, len(meta.fields))
+		column      string
+		v           = make([]byte, 0, 2*len(meta.fields))
 	)
 
 	//寻找数据库字段和值
-	for i := 0; i < fieldCount; i++ {
-		dbField = t.Field(i).Tag.Get(tagName)
-		isRequired = false
-
-		if dbField == "" {
-			continue
-		}
-
-		tags := strings.Split(dbField, ",")
-		dbField = tags[0]
-		for _, val := range tags {
-			if val == required {
-				isRequired = true
-				break
-			}
-		}
-
-		if !isRequired && value.Field(i).IsZero() {
+	for _, field := range meta.fields {
+		if !field.required && value.Field(field.index).IsZero() {
 			continue
 		}
 
 		dbFieldCount++
-		dbFieldList = append(dbFieldList, t.Field(i).Name)
+		dbFieldList = append(dbFieldList, field.index)
+		column = "`" + field.column + "`"
+		if !field.primary {
+			updateFields = append(updateFields, column)
+		}
 
 		if dbFieldCount > 1 {
 			v = append(v, ',')
 			sqlBuffer.WriteByte(',')
 		} else {
 			v = append(v, '(')
-			sqlBuffer.WriteString("INSERT INTO ")
+			sqlBuffer.WriteString(verb)
 			sqlBuffer.WriteByte('`')
-			sqlBuffer.WriteString(tableName(value))
+			sqlBuffer.WriteString(meta.table)
 			sqlBuffer.WriteByte('`')
 			sqlBuffer.WriteByte('(')
 		}
 
 		v = append(v, '?')
-		sqlBuffer.WriteByte('`')
-		sqlBuffer.WriteString(dbField)
-		sqlBuffer.WriteByte('`')
-		*args = append(*args, value.Field(i).Interface())
+		sqlBuffer.WriteString(column)
+		*args = append(*args, value.Field(field.index).Interface())
 	}
 
 	//没有找到字段
 	if dbFieldCount < 1 {
-		return "", ErrNotFoundField
+		return "", nil, ErrNotFoundField
 	}
 
 	sqlBuffer.WriteByte(')')
@@ -182,13 +146,93 @@ func SqlInsertObjs(args *[]interface{}, rows interface{}) (sql string, err error
 		for start := 1; start < len(values); start++ {
 			sqlBuffer.WriteByte(',')
 			sqlBuffer.Write(v)
-			for _, fieldName := range dbFieldList {
-				*args = append(*args, values[start].FieldByName(fieldName).Interface())
+			for _, fieldIndex := range dbFieldList {
+				*args = append(*args, values[start].Field(fieldIndex).Interface())
 			}
 		}
 	}
 
-	return sqlBuffer.String(), nil
+	return sqlBuffer.String(), updateFields, nil
+}
+
+// objValues 获取*struct或[]*struct的指针列表，元素类型必须一致
+func objValues(rows interface{}) (values []reflect.Value, err error) {
+	vRows := reflect.ValueOf(rows)
+
+	switch vRows.Kind() {
+	case reflect.Slice:
+		values = make([]reflect.Value, 0, vRows.Len())
+		for i := 0; i < vRows.Len(); i++ {
+			value := vRows.Index(i)
+
+			if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+				return nil, ErrInvalidRowsTypes
+			}
+
+			values = append(values, value)
+		}
+	case reflect.Ptr:
+		if vRows.Elem().Kind() != reflect.Struct {
+			return nil, ErrInvalidRowsTypes
+		}
+
+		values = []reflect.Value{vRows}
+	default:
+		return nil, ErrInvalidRowsTypes
+	}
+
+	if len(values) < 1 {
+		return nil, ErrInvalidRowsTypes
+	}
+
+	for _, value := range values[1:] {
+		if value.Elem().Type() != values[0].Elem().Type() {
+			return nil, ErrInvalidRowsTypes
+		}
+	}
+
+	return values, nil
+}
+
+// fillInsertId 将自增ID回写到插入对象的主键字段
+//
+// 多行插入依赖MySQL对单条INSERT语句分配连续自增ID的保证，
+// 第一个对象的主键不为零值（插入了显式主键）时不回写
+func fillInsertId(rows interface{}, result sql.Result) error {
+	values, err := objValues(rows)
+	if err != nil {
+		return err
+	}
+
+	meta := getModelMeta(values[0].Elem().Type())
+	if len(meta.primary) != 1 {
+		return nil
+	}
+
+	index := meta.fields[meta.primary[0]].index
+	if !values[0].Elem().Field(index).IsZero() {
+		return nil
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil || id < 1 {
+		return err
+	}
+
+	for offset, value := range values {
+		field := value.Elem().Field(index)
+
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			field.SetInt(id + int64(offset))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			field.SetUint(uint64(id + int64(offset)))
+		default:
+			return nil
+		}
+	}
+
+	return nil
 }
 
 // SqlDeleteByObj ---
@@ -209,47 +253,19 @@ func SqlDeleteByObj(args *[]interface{}, obj interface{}) (sqlStr string, err er
 	}
 
 	var (
-		t          = value.Type()
-		fieldCount = value.NumField()
-
-		dbField   string
-		isPrimary bool
-		fm        = make(FieldMap, 2)
+		meta = getModelMeta(value.Type())
 	)
 
-	//寻找数据库字段和值
-	for i := 0; i < fieldCount; i++ {
-		dbField = t.Field(i).Tag.Get(tagName)
-		isPrimary = false
-
-		if dbField == "" {
-			continue
-		}
-
-		tags := strings.Split(dbField, ",")
-		dbField = "`" + tags[0] + "`"
-		for _, val := range tags {
-			if strings.TrimSpace(val) == primary {
-				isPrimary = true
-			}
-		}
-
-		if isPrimary {
-			fm[dbField] = []interface{}{value.Field(i).Interface()}
-			continue
-		}
-	}
-
 	//没有找到主键
-	if len(fm) < 1 {
+	if len(meta.primary) < 1 {
 		return "", ErrNotFoundPrimaryField
 	}
 
 	sqlBuffer.WriteString("DELETE FROM ")
 	sqlBuffer.WriteByte('`')
-	sqlBuffer.WriteString(tableName(value))
+	sqlBuffer.WriteString(meta.table)
 	sqlBuffer.WriteByte('`')
-	sqlBuffer.WriteString(NewWhere(AndCondition(fm)).Sql(args))
+	sqlBuffer.WriteString(NewWhere(AndOrderedCondition(meta.primaryFields(value))).Sql(args))
 
 	return sqlBuffer.String(), nil
 }
@@ -262,61 +278,27 @@ func SqlUpdateByObj(args *[]interface{}, obj interface{}) (sqlStr string, err er
 		value = reflect.ValueOf(obj)
 	)
 
-	if value.Kind() != reflect.Ptr {
-		return "", ErrInvalidTypes
-	}
-
-	if bs := value.MethodByName(beforeSave); bs.Kind() == reflect.Func {
-		bs.Call(nil)
-	}
-
-	if bc := value.MethodByName(beforeUpdate); bc.Kind() == reflect.Func {
-		bc.Call(nil)
-	}
-
-	value = value.Elem()
-	if value.Kind() != reflect.Struct {
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
 		return "", ErrInvalidTypes
 	}
 
 	var (
-		t          = value.Type()
-		fieldCount = value.NumField()
-
-		dbField     string
-		isRequired  bool
-		isPrimary   bool
+		meta        = getModelMeta(value.Elem().Type())
 		hasSetField bool
-		fm          = make(FieldMap, 2)
 	)
 
-	//寻找数据库字段和值
-	for i := 0; i < fieldCount; i++ {
-		dbField = t.Field(i).Tag.Get(tagName)
-		isRequired = false
-		isPrimary = false
+	callHook(value, meta.beforeSave)
+	callHook(value, meta.beforeUpdate)
 
-		if dbField == "" {
-			continue
-		}
-
-		tags := strings.Split(dbField, ",")
-		dbField = tags[0]
-		for _, val := range tags {
-			switch strings.TrimSpace(val) {
-			case required:
-				isRequired = true
-			case primary:
-				isPrimary = true
-			}
-		}
+	value = value.Elem()
 
-		if isPrimary {
-			fm[dbField] = []interface{}{value.Field(i).Interface()}
+	//寻找数据库字段和值
+	for _, field := range meta.fields {
+		if field.primary {
 			continue
 		}
 
-		if !isRequired && value.Field(i).IsZero() {
+		if !field.required && value.Field(field.index).IsZero() {
 			continue
 		}
 
@@ -326,16 +308,16 @@ func SqlUpdateByObj(args *[]interface{}, obj interface{}) (sqlStr string, err er
 			hasSetField = true
 			sqlBuffer.WriteString("UPDATE ")
 			sqlBuffer.WriteByte('`')
-			sqlBuffer.WriteString(tableName(value))
+			sqlBuffer.WriteString(meta.table)
 			sqlBuffer.WriteByte('`')
 			sqlBuffer.WriteString(" SET ")
 		}
 
 		sqlBuffer.WriteByte('`')
-		sqlBuffer.WriteString(dbField)
+		sqlBuffer.WriteString(field.column)
 		sqlBuffer.WriteByte('`')
 		sqlBuffer.WriteString("=?")
-		*args = append(*args, value.Field(i).Interface())
+		*args = append(*args, value.Field(field.index).Interface())
 	}
 
 	if !hasSetField {
@@ -343,10 +325,10 @@ func SqlUpdateByObj(args *[]interface{}, obj interface{}) (sqlStr string, err er
 	}
 
 	//没有找到主键
-	if len(fm) < 1 {
+	if len(meta.primary) < 1 {
 		return "", ErrNotFoundPrimaryField
 	}
 
-	sqlBuffer.WriteString(NewWhere(AndCondition(fm)).Sql(args))
+	sqlBuffer.WriteString(NewWhere(AndOrderedCondition(meta.primaryFields(value))).Sql(args))
 	return sqlBuffer.String(), nil
 }
@@ -0,0 +1,281 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = `closed`
+	BreakerOpen     = `open`
+	BreakerHalfOpen = `halfOpen`
+)
+
+// BreakerOption 连接池熔断配置，错误率或慢请求比例在滑动窗口内超过阈值时熔断，
+// 熔断OpenTimeout后进入半开状态，放行探测请求，连续HalfOpenProbes次成功后恢复
+type BreakerOption struct {
+	//滑动窗口长度，单位s，默认10
+	Window int64 `yaml:"window" json:"window"`
+	//窗口内请求数达到MinRequests后才判断是否熔断，默认20
+	MinRequests int64 `yaml:"minRequests" json:"minRequests"`
+	//错误率阈值，取值0~1，0为不按错误率熔断
+	ErrorRate float64 `yaml:"errorRate" json:"errorRate"`
+	//慢请求阈值，单位ms
+	SlowThreshold int64 `yaml:"slowThreshold" json:"slowThreshold"`
+	//慢请求比例阈值，取值0~1，0为不按慢请求熔断
+	SlowRate float64 `yaml:"slowRate" json:"slowRate"`
+	//熔断持续时间，单位s，默认5
+	OpenTimeout int64 `yaml:"openTimeout" json:"openTimeout"`
+	//半开状态恢复所需的连续成功探测次数，默认1
+	HalfOpenProbes int64 `yaml:"halfOpenProbes" json:"halfOpenProbes"`
+}
+
+// validate 校验时间和次数不为负数，比例取值0~1
+func (bo *BreakerOption) validate() error {
+	if bo.Window < 0 || bo.MinRequests < 0 || bo.SlowThreshold < 0 || bo.OpenTimeout < 0 || bo.HalfOpenProbes < 0 {
+		return ErrInvalidOption
+	}
+
+	if bo.ErrorRate < 0 || bo.ErrorRate > 1 || bo.SlowRate < 0 || bo.SlowRate > 1 {
+		return ErrInvalidOption
+	}
+	return nil
+}
+
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	epoch    int64
+	total    int64
+	failures int64
+	slow     int64
+}
+
+// breaker 连接池熔断器，方法对nil安全，nil表示未开启熔断
+type breaker struct {
+	mutex sync.Mutex
+
+	option     BreakerOption
+	bucketSize time.Duration
+	slow       time.Duration
+	timeout    time.Duration
+
+	buckets  [breakerBuckets]breakerBucket
+	state    string
+	openedAt time.Time
+	probing  time.Time
+	probes   int64
+
+	onChange func(up bool)
+}
+
+func newBreaker(option *BreakerOption, onChange func(up bool)) *breaker {
+	if option == nil {
+		return nil
+	}
+
+	b := &breaker{
+		option:   *option,
+		state:    BreakerClosed,
+		onChange: onChange,
+	}
+
+	if b.option.Window < 1 {
+		b.option.Window = 10
+	}
+
+	if b.option.MinRequests < 1 {
+		b.option.MinRequests = 20
+	}
+
+	if b.option.OpenTimeout < 1 {
+		b.option.OpenTimeout = 5
+	}
+
+	if b.option.HalfOpenProbes < 1 {
+		b.option.HalfOpenProbes = 1
+	}
+
+	b.bucketSize = time.Duration(b.option.Window) * time.Second / breakerBuckets
+	b.slow = time.Duration(b.option.SlowThreshold) * time.Millisecond
+	b.timeout = time.Duration(b.option.OpenTimeout) * time.Second
+	return b
+}
+
+// State 熔断器状态
+func (b *breaker) State() string {
+	if b == nil {
+		return BreakerClosed
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+// ready 是否可以选择该连接池：关闭状态，或熔断已超时且没有进行中的探测
+func (b *breaker) ready(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		return now.Sub(b.openedAt) >= b.timeout
+	case BreakerHalfOpen:
+		return b.probing.IsZero() || now.Sub(b.probing) >= b.timeout
+	}
+	return true
+}
+
+// tryAcquire 选中连接池时调用，检查与获取在同一把锁内完成：关闭状态直接放行，
+// 熔断超时后进入半开状态并发放唯一的探测许可，许可被占用时返回false
+func (b *breaker) tryAcquire(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < b.timeout {
+			return false
+		}
+		b.state, b.probes, b.probing = BreakerHalfOpen, 0, now
+	case BreakerHalfOpen:
+		if !b.probing.IsZero() && now.Sub(b.probing) < b.timeout {
+			return false
+		}
+		b.probing = now
+	}
+	return true
+}
+
+// record 记录请求结果，半开状态仅统计获得探测许可后开始的请求，每个许可只统计一次
+func (b *breaker) record(now time.Time, duration time.Duration, err error) {
+	if b == nil {
+		return
+	}
+
+	var (
+		failed = isBreakerFailure(err)
+		slow   = b.slow > 0 && duration >= b.slow
+		start  = now.Add(-duration)
+	)
+
+	b.mutex.Lock()
+
+	var changed, up bool
+	switch b.state {
+	case BreakerHalfOpen:
+		//熔断前或发放许可前开始的请求不是探测请求
+		if b.probing.IsZero() || start.Before(b.probing) {
+			break
+		}
+
+		b.probing = time.Time{}
+		if failed || slow {
+			b.state, b.openedAt = BreakerOpen, now
+		} else if b.probes++; b.probes >= b.option.HalfOpenProbes {
+			b.state, b.buckets = BreakerClosed, [breakerBuckets]breakerBucket{}
+			changed, up = true, true
+		}
+	case BreakerClosed:
+		b.add(now, failed, slow)
+		if b.shouldTrip(now) {
+			b.state, b.openedAt = BreakerOpen, now
+			changed = true
+		}
+	}
+
+	b.mutex.Unlock()
+
+	if changed && b.onChange != nil {
+		b.onChange(up)
+	}
+}
+
+func (b *breaker) add(now time.Time, failed, slow bool) {
+	epoch := now.UnixNano() / int64(b.bucketSize)
+	bucket := &b.buckets[epoch%breakerBuckets]
+	if bucket.epoch != epoch {
+		*bucket = breakerBucket{epoch: epoch}
+	}
+
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+
+	if slow {
+		bucket.slow++
+	}
+}
+
+func (b *breaker) shouldTrip(now time.Time) bool {
+	var (
+		epoch                 = now.UnixNano() / int64(b.bucketSize)
+		total, failures, slow int64
+	)
+
+	for _, bucket := range b.buckets {
+		if bucket.epoch > epoch-breakerBuckets {
+			total += bucket.total
+			failures += bucket.failures
+			slow += bucket.slow
+		}
+	}
+
+	if total < b.option.MinRequests {
+		return false
+	}
+
+	if b.option.ErrorRate > 0 && float64(failures)/float64(total) >= b.option.ErrorRate {
+		return true
+	}
+
+	return b.option.SlowRate > 0 && float64(slow)/float64(total) >= b.option.SlowRate
+}
+
+// isBreakerFailure 连接池故障类错误，业务错误（如唯一键冲突）不计入
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	kind := ErrorKind(err)
+	return kind == ErrConnection || kind == ErrTooManyConns
+}
+
+// breakerOf 获取连接池的熔断器
+func (g *group) breakerOf(role string, index int) *breaker {
+	if role == RoleMaster {
+		return g.masterBreakers[index]
+	}
+	return g.slaveBreakers[index]
+}
+
+// record 记录连接池上的语句执行结果
+func (g *group) record(role string, index int, start time.Time, err error) {
+	now := time.Now()
+	g.breakerOf(role, index).record(now, now.Sub(start), err)
+}
+
+func (g *group) breakerNotifier(role string, index int) func(up bool) {
+	return func(up bool) {
+		g.notify(role, index, up)
+	}
+}
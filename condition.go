@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"sort"
 	"strings"
 )
 
@@ -12,22 +13,62 @@ const (
 // FieldMap 列条件
 type FieldMap map[string][]interface{}
 
+// FieldItem 列条件项
+type FieldItem struct {
+	Field string
+	Value []interface{}
+}
+
+// OrderedFieldMap 有序列条件，按切片顺序生成条件
+type OrderedFieldMap []FieldItem
+
+// Ordered 按字段名排序转换为OrderedFieldMap
+func (fm FieldMap) Ordered() OrderedFieldMap {
+	fields := make([]string, 0, len(fm))
+	for field := range fm {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	items := make(OrderedFieldMap, 0, len(fields))
+	for _, field := range fields {
+		items = append(items, FieldItem{Field: field, Value: fm[field]})
+	}
+	return items
+}
+
 // Condition 条件
 type Condition interface {
 	Opt() (opt string)
 	Sql(args *[]interface{}) (sql string)
 }
 
-// OrCondition Or条件
+// OrCondition Or条件，字段按字段名排序
 func OrCondition(fields FieldMap) Condition {
 	return condition{
 		opt:    Or,
-		fields: fields,
+		fields: fields.Ordered(),
 	}
 }
 
-// AndCondition And条件
+// AndCondition And条件，字段按字段名排序
 func AndCondition(fields FieldMap) Condition {
+	return condition{
+		opt:    And,
+		fields: fields.Ordered(),
+	}
+}
+
+// OrOrderedCondition 有序Or条件
+func OrOrderedCondition(fields OrderedFieldMap) Condition {
+	return condition{
+		opt:    Or,
+		fields: fields,
+	}
+}
+
+// AndOrderedCondition 有序And条件
+func AndOrderedCondition(fields OrderedFieldMap) Condition {
 	return condition{
 		opt:    And,
 		fields: fields,
@@ -36,7 +77,7 @@ func AndCondition(fields FieldMap) Condition {
 
 type condition struct {
 	opt    string
-	fields FieldMap
+	fields OrderedFieldMap
 }
 
 // Opt condition类型
@@ -56,17 +97,17 @@ func (c condition) Sql(args *[]interface{}) (sql string) {
 		hasCondition bool
 	)
 
-	for field, value := range c.fields {
+	for _, item := range c.fields {
+		field, value := item.Field, item.Value
 		if len(value) < 1 {
 			continue
 		}
 
 		if len(value) > 1 {
 			operator = strings.ToUpper(value[0].(string))
-			*args = append(*args, value[1:]...)
+			value = value[1:]
 		} else {
 			operator = `=`
-			*args = append(*args, value...)
 		}
 
 		if !hasCondition {
@@ -83,20 +124,125 @@ func (c condition) Sql(args *[]interface{}) (sql string) {
 		switch operator {
 		case "IN":
 			buf.WriteString(" IN(")
-			for index := 1; index < len(value); index++ {
-				if index > 1 {
+			for index, val := range value {
+				if index > 0 {
 					buf.WriteByte(',')
 				}
-				buf.WriteByte('?')
+				buf.WriteString(placeholder(args, val))
 			}
 			buf.WriteByte(')')
 		case "BETWEEN":
-			buf.WriteString(" BETWEEN ? AND ?")
+			buf.WriteString(" BETWEEN ")
+			buf.WriteString(placeholder(args, value[0]))
+			buf.WriteString(" AND ")
+			if len(value) > 1 {
+				buf.WriteString(placeholder(args, value[1]))
+			} else {
+				buf.WriteString(placeholder(args, nil))
+			}
 		default:
 			buf.WriteByte(' ')
 			buf.WriteString(operator)
-			buf.WriteString(" ?")
+			buf.WriteByte(' ')
+			buf.WriteString(placeholder(args, value[0]))
+		}
+	}
+
+	if !hasCondition {
+		return
+	}
+
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// On 列比较条件，常用于Join的ON子句，如：On("`u`.`id`", "`o`.`user_id`")
+func On(left, right string) Condition {
+	return onCondition{
+		left:  left,
+		right: right,
+	}
+}
+
+type onCondition struct {
+	left  string
+	right string
+}
+
+// Opt condition类型
+func (oc onCondition) Opt() (opt string) {
+	return And
+}
+
+// Sql 生成sql
+func (oc onCondition) Sql(args *[]interface{}) (sql string) {
+	if oc.left == "" || oc.right == "" {
+		return
+	}
+
+	return "(" + oc.left + " = " + oc.right + ")"
+}
+
+// All 嵌套And条件，所有子条件需同时满足
+func All(conditions ...Condition) Condition {
+	return nestedCondition{
+		opt:        And,
+		conditions: conditions,
+	}
+}
+
+// Any 嵌套Or条件，任一子条件满足即可
+func Any(conditions ...Condition) Condition {
+	return nestedCondition{
+		opt:        Or,
+		conditions: conditions,
+	}
+}
+
+// Not 条件取反
+func Not(condition Condition) Condition {
+	return notCondition{
+		condition: condition,
+	}
+}
+
+type nestedCondition struct {
+	opt        string
+	conditions []Condition
+}
+
+// Opt condition类型
+func (nc nestedCondition) Opt() (opt string) {
+	return nc.opt
+}
+
+// Sql 生成sql
+func (nc nestedCondition) Sql(args *[]interface{}) (sql string) {
+	var (
+		buf          strings.Builder
+		hasCondition bool
+	)
+
+	for _, condition := range nc.conditions {
+		if condition == nil {
+			continue
+		}
+
+		sqlStr := condition.Sql(args)
+		if sqlStr == "" {
+			continue
 		}
+
+		if !hasCondition {
+			hasCondition = true
+			buf.WriteByte('(')
+		} else {
+			buf.WriteByte(' ')
+			buf.WriteString(nc.opt)
+			buf.WriteByte(' ')
+		}
+
+		buf.WriteString(sqlStr)
 	}
 
 	if !hasCondition {
@@ -106,3 +252,26 @@ func (c condition) Sql(args *[]interface{}) (sql string) {
 	buf.WriteByte(')')
 	return buf.String()
 }
+
+type notCondition struct {
+	condition Condition
+}
+
+// Opt condition类型
+func (nc notCondition) Opt() (opt string) {
+	return And
+}
+
+// Sql 生成sql
+func (nc notCondition) Sql(args *[]interface{}) (sql string) {
+	if nc.condition == nil {
+		return
+	}
+
+	sqlStr := nc.condition.Sql(args)
+	if sqlStr == "" {
+		return
+	}
+
+	return "(NOT " + sqlStr + ")"
+}
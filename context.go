@@ -0,0 +1,59 @@
+package orm
+
+import (
+	"context"
+	"time"
+)
+
+type masterKey struct{}
+
+type txKey struct{}
+
+type maxLagKey struct{}
+
+type idempotentKey struct{}
+
+// WithMaster 标记ctx上的查询走主库，用于泛型查询函数
+func WithMaster(ctx context.Context) context.Context {
+	return context.WithValue(ctx, masterKey{}, true)
+}
+
+func useMasterFrom(ctx context.Context) bool {
+	useMaster, _ := ctx.Value(masterKey{}).(bool)
+	return useMaster
+}
+
+// WithTransaction 将事务绑定到ctx，开启该事务的Group的*Context方法将在该事务上执行，其他Group忽略该事务
+func WithTransaction(ctx context.Context, tx Transaction) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// TransactionFrom 获取ctx上绑定的事务
+func TransactionFrom(ctx context.Context) (tx Transaction, ok bool) {
+	tx, ok = ctx.Value(txKey{}).(Transaction)
+	return tx, ok && tx != nil
+}
+
+// WithMaxLag 设置ctx上查询可接受的最大从库复制延迟，覆盖GroupOption中的配置
+func WithMaxLag(ctx context.Context, maxLag time.Duration) context.Context {
+	return context.WithValue(ctx, maxLagKey{}, maxLag)
+}
+
+// maxLag 获取最大从库复制延迟，单位ms，0为不限制
+func (g *group) maxLag(ctx context.Context) int64 {
+	if maxLag, ok := ctx.Value(maxLagKey{}).(time.Duration); ok {
+		return maxLag.Milliseconds()
+	}
+	return g.maxLagMs
+}
+
+// WithIdempotent 标记ctx上的写操作可重复执行，RetryPolicy将对其重试所有可重试错误，
+// 否则写操作仅在语句未发送到服务端时重试
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func idempotentFrom(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"strconv"
 	"strings"
@@ -14,7 +15,7 @@ func (g *group) Tables(pattern string, useMaster bool) (tableList []string, err
 		sqlStr  = `SHOW TABLES`
 	)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(context.Background(), func(mPool Pool) (*sql.Rows, error) {
 		if pattern == "" {
 			return mPool.Query(sqlStr)
 		}
@@ -43,7 +44,7 @@ func (g *group) Table(table string, useMaster bool) (t *Table, err error) {
 		sqlStr  = `SHOW FULL COLUMNS FROM ` + table
 	)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(context.Background(), func(mPool Pool) (*sql.Rows, error) {
 		return mPool.Query(sqlStr)
 	}, useMaster)
 
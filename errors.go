@@ -0,0 +1,113 @@
+package orm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// 错误分类，使用errors.Is判断，如：errors.Is(err, ErrDuplicateKey)
+var (
+	ErrDuplicateKey = errors.New(`mysql: duplicate key`)
+	ErrDeadlock     = errors.New(`mysql: deadlock found`)
+	ErrLockTimeout  = errors.New(`mysql: lock wait timeout exceeded`)
+	ErrReadOnly     = errors.New(`mysql: server is read-only`)
+	ErrConnection   = errors.New(`mysql: connection error`)
+	ErrTooManyConns = errors.New(`mysql: too many connections`)
+	ErrNotFound     = errors.New(`mysql: record not found`)
+)
+
+// mysqlErrorKinds MySQL错误码与错误分类的映射
+var mysqlErrorKinds = map[uint16]error{
+	1062: ErrDuplicateKey, // ER_DUP_ENTRY
+	1586: ErrDuplicateKey, // ER_DUP_ENTRY_WITH_KEY_NAME
+	1213: ErrDeadlock,     // ER_LOCK_DEADLOCK
+	1205: ErrLockTimeout,  // ER_LOCK_WAIT_TIMEOUT
+	1290: ErrReadOnly,     // ER_OPTION_PREVENTS_STATEMENT(--read-only)
+	1792: ErrReadOnly,     // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION
+	1836: ErrReadOnly,     // ER_READ_ONLY_MODE
+	1040: ErrTooManyConns, // ER_CON_COUNT_ERROR
+	1203: ErrTooManyConns, // ER_TOO_MANY_USER_CONNECTIONS
+	1053: ErrConnection,   // ER_SERVER_SHUTDOWN
+	1927: ErrConnection,   // ER_CONNECTION_KILLED
+}
+
+// Error 已分类的数据库错误，errors.Is匹配分类，errors.As/Unwrap可获取原始错误
+type Error struct {
+	// Kind 错误分类，如ErrDeadlock
+	Kind error
+	// Number MySQL错误码，非MySQL服务端错误为0
+	Number uint16
+	// Err 原始错误
+	Err error
+}
+
+// Error 原始错误信息
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap 原始错误
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 匹配错误分类
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// ErrorKind 获取错误分类，如ErrDeadlock，无法分类时返回nil
+func ErrorKind(err error) error {
+	kind, _ := classify(err)
+	return kind
+}
+
+// classify 获取错误分类，无法分类时返回nil
+func classify(err error) (kind error, number uint16) {
+	if err == nil {
+		return nil, 0
+	}
+
+	var ormErr *Error
+	if errors.As(err, &ormErr) {
+		return ormErr.Kind, ormErr.Number
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErrorKinds[mysqlErr.Number], mysqlErr.Number
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound, 0
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return ErrConnection, 0
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return ErrConnection, 0
+	}
+
+	return nil, 0
+}
+
+// wrapError 将可分类的错误包装为*Error
+func wrapError(err error) error {
+	kind, number := classify(err)
+	if kind == nil {
+		return err
+	}
+
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+
+	return &Error{Kind: kind, Number: number, Err: err}
+}
@@ -1,71 +1,147 @@
 package orm
 
 import (
+	"sort"
 	"strings"
 )
 
+const (
+	insertInto       = `INSERT INTO `
+	insertIgnoreInto = `INSERT IGNORE INTO `
+	replaceInto      = `REPLACE INTO `
+)
+
 // Row 行
 type Row map[string]interface{}
 
-// SqlInsert 生成插入sql
+// Pair 字段与值
+type Pair struct {
+	Field string
+	Value interface{}
+}
+
+// OrderedRow 有序行，按切片顺序生成字段
+type OrderedRow []Pair
+
+// Ordered 按字段名排序转换为OrderedRow
+func (r Row) Ordered() OrderedRow {
+	fields := make([]string, 0, len(r))
+	for field := range r {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	row := make(OrderedRow, 0, len(fields))
+	for _, field := range fields {
+		row = append(row, Pair{Field: field, Value: r[field]})
+	}
+	return row
+}
+
+func orderedRows(rows []Row) []OrderedRow {
+	list := make([]OrderedRow, len(rows))
+	for index, row := range rows {
+		list[index] = row.Ordered()
+	}
+	return list
+}
+
+// Get 获取字段值
+func (or OrderedRow) Get(field string) (value interface{}) {
+	for _, pair := range or {
+		if pair.Field == field {
+			return pair.Value
+		}
+	}
+	return nil
+}
+
+// values 字段到值的映射
+func (or OrderedRow) values() map[string]interface{} {
+	values := make(map[string]interface{}, len(or))
+	for _, pair := range or {
+		values[pair.Field] = pair.Value
+	}
+	return values
+}
+
+// SqlInsert 生成插入sql，字段按字段名排序
 func SqlInsert(args *[]interface{}, table string, rows ...Row) (sql string) {
-	if len(rows) < 0 {
+	if len(rows) < 1 {
+		return ""
+	}
+
+	return SqlInsertOrdered(args, table, orderedRows(rows)...)
+}
+
+// SqlInsertOrdered 生成插入sql，字段按第一行的顺序生成
+func SqlInsertOrdered(args *[]interface{}, table string, rows ...OrderedRow) (sql string) {
+	return sqlInsert(args, insertInto, table, rows)
+}
+
+func sqlInsert(args *[]interface{}, verb string, table string, rows []OrderedRow) (sql string) {
+	if len(rows) < 1 || len(rows[0]) < 1 {
 		return ""
 	}
 
 	var (
 		sqlBuffer strings.Builder
 
-		first       = true
-		row         = rows[0]
-		dbFieldList = make([]string, 0, len(rows))
-		v           = make([]byte, 0, 2*len(rows))
+		row = rows[0]
 	)
 
-	for field, value := range row {
-		if first {
-			first = false
-			v = append(v, '(')
-			sqlBuffer.WriteString("INSERT INTO ")
-			sqlBuffer.WriteString(table)
-			sqlBuffer.WriteByte('(')
-		} else {
-			v = append(v, ',')
+	sqlBuffer.WriteString(verb)
+	sqlBuffer.WriteString(table)
+	sqlBuffer.WriteByte('(')
+	for index, pair := range row {
+		if index > 0 {
 			sqlBuffer.WriteByte(',')
 		}
-
-		dbFieldList = append(dbFieldList, field)
-		v = append(v, '?')
-		sqlBuffer.WriteString(field)
-		*args = append(*args, value)
-	}
-
-	//没有找到字段
-	if first {
-		return ""
+		sqlBuffer.WriteString(pair.Field)
 	}
-
 	sqlBuffer.WriteByte(')')
-	v = append(v, ')')
 
 	sqlBuffer.WriteString("VALUES")
-	sqlBuffer.Write(v)
-
-	if len(rows) > 1 {
-		for start := 1; start < len(rows); start++ {
+	for start := 0; start < len(rows); start++ {
+		if start > 0 {
 			sqlBuffer.WriteByte(',')
-			sqlBuffer.Write(v)
-			for _, field := range dbFieldList {
-				*args = append(*args, rows[start][field])
+		}
+
+		var (
+			current = rows[start]
+			values  map[string]interface{}
+		)
+
+		sqlBuffer.WriteByte('(')
+		for index, pair := range row {
+			if index > 0 {
+				sqlBuffer.WriteByte(',')
 			}
+
+			//字段顺序与第一行一致时直接按位置取值，否则每行只构建一次映射
+			if index < len(current) && current[index].Field == pair.Field {
+				sqlBuffer.WriteString(placeholder(args, current[index].Value))
+				continue
+			}
+
+			if values == nil {
+				values = current.values()
+			}
+			sqlBuffer.WriteString(placeholder(args, values[pair.Field]))
 		}
+		sqlBuffer.WriteByte(')')
 	}
 
 	return sqlBuffer.String()
 }
 
-// SqlUpdate 生成更新sql
+// SqlUpdate 生成更新sql，字段按字段名排序
 func SqlUpdate(args *[]interface{}, table string, set Row, where Where) (sql string) {
+	return SqlUpdateOrdered(args, table, set.Ordered(), where)
+}
+
+// SqlUpdateOrdered 生成更新sql，字段按set的顺序生成
+func SqlUpdateOrdered(args *[]interface{}, table string, set OrderedRow, where Where) (sql string) {
 	var (
 		sqlBuffer strings.Builder
 
@@ -75,16 +151,16 @@ func SqlUpdate(args *[]interface{}, table string, set Row, where Where) (sql str
 	sqlBuffer.WriteString(table)
 	sqlBuffer.WriteString(` SET `)
 
-	for field, arg := range set {
+	for _, pair := range set {
 		if num > 0 {
 			sqlBuffer.WriteByte(',')
 		} else {
 			num++
 		}
 
-		sqlBuffer.WriteString(field)
-		sqlBuffer.WriteString("=?")
-		*args = append(*args, arg)
+		sqlBuffer.WriteString(pair.Field)
+		sqlBuffer.WriteByte('=')
+		sqlBuffer.WriteString(placeholder(args, pair.Value))
 	}
 
 	if where != nil {
@@ -0,0 +1,31 @@
+package orm
+
+// Expression 原生sql表达式，渲染时原样写入sql并附加其绑定参数
+type Expression struct {
+	sql  string
+	args []interface{}
+}
+
+// Expr 实例化原生sql表达式，如：Expr("`count`+?", 1)、Expr("NOW()")
+func Expr(sql string, args ...interface{}) Expression {
+	return Expression{
+		sql:  sql,
+		args: args,
+	}
+}
+
+// Sql 生成sql
+func (e Expression) Sql(args *[]interface{}) (sql string) {
+	*args = append(*args, e.args...)
+	return e.sql
+}
+
+// placeholder 生成值的占位符，Expression原样写入，其他值写入?并附加参数
+func placeholder(args *[]interface{}, value interface{}) string {
+	if expr, ok := value.(Expression); ok {
+		return expr.Sql(args)
+	}
+
+	*args = append(*args, value)
+	return "?"
+}
@@ -0,0 +1,100 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+
+	"github.com/grpc-boot/base"
+)
+
+// Querier Group与Transaction共同实现的查询接口，用于泛型查询函数
+type Querier interface {
+	queryContext(ctx context.Context, useMaster bool, sqlStr string, args ...interface{}) (rows *sql.Rows, err error)
+}
+
+// FindAll 根据Query查询，返回*T列表
+func FindAll[T any](ctx context.Context, q Querier, query Query) (list []*T, err error) {
+	var (
+		args   = base.AcquireArgs()
+		sqlStr = query.Sql(&args)
+	)
+
+	defer base.ReleaseArgs(&args)
+
+	return findAll[T](ctx, q, sqlStr, args)
+}
+
+// FindOne 根据Where查询一个*T，未找到时返回ErrNotFound
+func FindOne[T any](ctx context.Context, q Querier, where Where) (obj *T, err error) {
+	var (
+		args = base.AcquireArgs()
+		t    T
+	)
+
+	defer base.ReleaseArgs(&args)
+
+	sqlStr, err := SqlFindOneObj(&args, where, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := findAll[T](ctx, q, sqlStr, args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) < 1 {
+		return nil, ErrNotFound
+	}
+	return list[0], nil
+}
+
+// FindByPk 根据主键查询一个*T，未找到时返回ErrNotFound
+func FindByPk[T any](ctx context.Context, q Querier, pk interface{}) (obj *T, err error) {
+	column, err := primaryColumn(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	return FindOne[T](ctx, q, AndWhere(FieldMap{
+		"`" + column + "`": {pk},
+	}))
+}
+
+func findAll[T any](ctx context.Context, q Querier, sqlStr string, args []interface{}) (list []*T, err error) {
+	var (
+		rows *sql.Rows
+		t    T
+	)
+
+	rows, err = q.queryContext(ctx, useMasterFrom(ctx), sqlStr, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	objList, err := ToObjList(rows, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	list = make([]*T, 0, len(objList))
+	for _, obj := range objList {
+		list = append(list, obj.(reflect.Value).Addr().Interface().(*T))
+	}
+	return list, nil
+}
+
+func primaryColumn(t reflect.Type) (column string, err error) {
+	if t.Kind() != reflect.Struct {
+		return "", ErrInvalidTypes
+	}
+
+	meta := getModelMeta(t)
+	if len(meta.primary) < 1 {
+		return "", ErrNotFoundPrimaryField
+	}
+
+	return meta.fields[meta.primary[0]].column, nil
+}
@@ -3,19 +3,26 @@ package orm
 import (
 	"context"
 	"database/sql"
-	"database/sql/driver"
 	"errors"
-	"log"
-	"net"
+	"fmt"
+	"math"
+	"sync"
 	"time"
 
 	"github.com/grpc-boot/base"
 	"go.uber.org/atomic"
 )
 
+const (
+	RoleMaster = `master`
+	RoleSlave  = `slave`
+)
+
 var (
-	ErrNoMasterConn = errors.New("mysql group: no master connection available")
-	ErrNoSlaveConn  = errors.New("mysql group: no slave connection available")
+	ErrNoMasterConn     = errors.New("mysql group: no master connection available")
+	ErrNoSlaveConn      = errors.New("mysql group: no slave connection available")
+	ErrInvalidOperation = errors.New("mysql group: invalid statement operation")
+	ErrEmptyReply       = errors.New("mysql group: interceptor returned an empty reply")
 )
 
 type GroupOption struct {
@@ -23,11 +30,58 @@ type GroupOption struct {
 	Slaves  []PoolOption `yaml:"slaves" json:"slaves"`
 	//单位s
 	RetryInterval int64 `yaml:"retryInterval" json:"retryInterval"`
+	//关闭InsertObj的自增ID回写，auto_increment_increment不为1时需关闭
+	DisableFillInsertId bool `yaml:"disableFillInsertId" json:"disableFillInsertId"`
+	//Transaction遇到死锁(1213)或锁等待超时(1205)时的重试次数，默认0为不重试
+	TransactionRetry int `yaml:"transactionRetry" json:"transactionRetry"`
+	//负载均衡策略：roundRobin(默认)、weighted、random、leastInUse或通过RegisterBalancer注册的策略
+	Balancer string `yaml:"balancer" json:"balancer"`
+	//后台健康检查间隔，单位s，0为关闭
+	HealthCheckInterval int64 `yaml:"healthCheckInterval" json:"healthCheckInterval"`
+	//写入后同一会话读主库的时间，单位ms，0为关闭
+	StickyMaster int64 `yaml:"stickyMaster" json:"stickyMaster"`
+	//从库复制延迟监控，nil为关闭
+	ReplicationLag *LagOption `yaml:"replicationLag" json:"replicationLag"`
+	//连接池熔断，nil为关闭
+	CircuitBreaker *BreakerOption `yaml:"circuitBreaker" json:"circuitBreaker"`
+	//瞬时错误重试策略，nil为不重试
+	RetryPolicy *RetryPolicy `yaml:"retryPolicy" json:"retryPolicy"`
+	//日志，默认为NewStdLogger(LevelError)
+	Logger Logger `yaml:"-" json:"-"`
+	//慢查询阈值，单位ms，超过时以Warn级别记录，0为关闭
+	SlowThreshold int64 `yaml:"slowThreshold" json:"slowThreshold"`
+	//日志中隐藏语句参数
+	RedactArgs bool `yaml:"redactArgs" json:"redactArgs"`
+}
+
+// PoolStats 连接池状态
+type PoolStats struct {
+	Role    string `json:"role"`
+	Index   int    `json:"index"`
+	Bad     bool   `json:"bad"`
+	BadTime int64  `json:"badTime"`
+	//熔断器状态：closed、open、halfOpen
+	Breaker string `json:"breaker"`
+	//复制延迟，单位ms，仅从库有效
+	Lag   int64       `json:"lag"`
+	Stats sql.DBStats `json:"stats"`
 }
 
 type Group interface {
-	// BadPool 获取BadPool列表
+	Querier
+
+	// BadPool 获取BadPool列表，包含熔断中的连接池
 	BadPool(isMaster bool) (list []int)
+	// Ping 检查所有主库和从库连接，并更新BadPool状态
+	Ping(ctx context.Context) (err error)
+	// Stats 获取所有连接池状态
+	Stats() (list []PoolStats)
+	// OnStateChange 注册连接池状态变化观察者
+	OnStateChange(observer StateObserver)
+	// Use 注册语句拦截器，作用于Query/Exec/Begin/Commit/Rollback，包括事务内的语句
+	Use(interceptors ...Interceptor)
+	// Close 停止后台任务并关闭所有连接池
+	Close() (err error)
 	// Query 查询
 	Query(useMaster bool, sqlStr string, args ...interface{}) (rows []map[string]string, err error)
 	// QueryContext with context 查询
@@ -41,9 +95,9 @@ type Group interface {
 	Tables(pattern string, useMaster bool) (tableList []string, err error)
 	Table(table string, useMaster bool) (t *Table, err error)
 
-	// InsertObj 插入对象
+	// InsertObj 插入对象，自增ID回写到primary字段
 	InsertObj(obj interface{}) (result sql.Result, err error)
-	// InsertObjContext with context 插入对象
+	// InsertObjContext with context 插入对象，自增ID回写到primary字段
 	InsertObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error)
 	// DeleteObj 删除对象
 	DeleteObj(obj interface{}) (result sql.Result, err error)
@@ -73,6 +127,14 @@ type Group interface {
 	Insert(table string, rows ...Row) (result sql.Result, err error)
 	// InsertContext with context 插入
 	InsertContext(ctx context.Context, table string, rows ...Row) (result sql.Result, err error)
+	// Upsert 插入，冲突时按option处理
+	Upsert(table string, option *UpsertOption, rows ...Row) (result sql.Result, err error)
+	// UpsertContext with context 插入，冲突时按option处理
+	UpsertContext(ctx context.Context, table string, option *UpsertOption, rows ...Row) (result sql.Result, err error)
+	// UpsertObj 插入对象，冲突时按option处理
+	UpsertObj(option *UpsertOption, obj interface{}) (result sql.Result, err error)
+	// UpsertObjContext with context 插入对象，冲突时按option处理
+	UpsertObjContext(ctx context.Context, option *UpsertOption, obj interface{}) (result sql.Result, err error)
 	// DeleteAll 删除
 	DeleteAll(table string, where Where) (result sql.Result, err error)
 	// DeleteAllContext with context 删除
@@ -81,11 +143,24 @@ type Group interface {
 	UpdateAll(table string, set Row, where Where) (result sql.Result, err error)
 	// UpdateAllContext with context 更新
 	UpdateAllContext(ctx context.Context, table string, set Row, where Where) (result sql.Result, err error)
+	// Increment 字段自增delta
+	Increment(table string, field string, delta interface{}, where Where) (result sql.Result, err error)
+	// IncrementContext with context 字段自增delta
+	IncrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error)
+	// Decrement 字段自减delta
+	Decrement(table string, field string, delta interface{}, where Where) (result sql.Result, err error)
+	// DecrementContext with context 字段自减delta
+	DecrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error)
 
 	// Begin 开启事务
 	Begin() (Transaction, error)
 	// BeginTx with context 开启事务
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (Transaction, error)
+	// Transaction 在事务中执行handler，返回nil提交，返回错误或panic时回滚，死锁和锁等待超时时按TransactionRetry重试(默认不重试)
+	// ctx上已绑定事务时，在该事务上基于保存点嵌套执行；handler内需通过tx执行语句，需要绑定事务的ctx时使用TransactionContext
+	Transaction(ctx context.Context, opts *sql.TxOptions, handler func(tx Transaction) error) (err error)
+	// TransactionContext 同Transaction，传给handler的ctx已绑定事务，handler内可使用该ctx调用Group的*Context方法
+	TransactionContext(ctx context.Context, opts *sql.TxOptions, handler func(ctx context.Context, tx Transaction) error) (err error)
 }
 
 type group struct {
@@ -95,7 +170,39 @@ type group struct {
 	masterBadPool map[int]*atomic.Int64
 	slaveBadPool  map[int]*atomic.Int64
 
+	masterBreakers map[int]*breaker
+	slaveBreakers  map[int]*breaker
+
+	slaveLag map[int]*atomic.Int64
+	maxLagMs int64
+
+	stickyMaster int64
+	sessions     sync.Map
+	sweepTime    atomic.Int64
+
+	masterNodes    []Node
+	slaveNodes     []Node
+	masterBalancer Balancer
+	slaveBalancer  Balancer
+
+	observerMutex sync.RWMutex
+	observers     []StateObserver
+
+	interceptorMutex sync.RWMutex
+	interceptors     []Interceptor
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	retry         *retryPolicy
+	logger        Logger
+	slowThreshold time.Duration
+	redactArgs    bool
+
 	retryInterval int64
+	fillInsertId  bool
+	txRetry       int
 	masterLen     int
 	slaveLen      int
 }
@@ -109,31 +216,105 @@ func NewMysqlGroup(groupOption *GroupOption) (Group, error) {
 		masterLen:     len(groupOption.Masters),
 		slaveLen:      len(groupOption.Slaves),
 		retryInterval: groupOption.RetryInterval,
+		fillInsertId:  !groupOption.DisableFillInsertId,
+		txRetry:       groupOption.TransactionRetry,
+		stickyMaster:  groupOption.StickyMaster,
+		logger:        groupOption.Logger,
+		slowThreshold: time.Duration(groupOption.SlowThreshold) * time.Millisecond,
+		redactArgs:    groupOption.RedactArgs,
 		masterBadPool: make(map[int]*atomic.Int64, len(groupOption.Masters)),
 		slaveBadPool:  make(map[int]*atomic.Int64, len(groupOption.Slaves)),
+		slaveLag:      make(map[int]*atomic.Int64, len(groupOption.Slaves)),
+
+		masterBreakers: make(map[int]*breaker, len(groupOption.Masters)),
+		slaveBreakers:  make(map[int]*breaker, len(groupOption.Slaves)),
+	}
+
+	if g.logger == nil {
+		g.logger = NewStdLogger(LevelError)
+	}
+
+	if groupOption.ReplicationLag != nil {
+		if err := groupOption.ReplicationLag.validate(); err != nil {
+			return nil, err
+		}
 	}
 
+	if groupOption.CircuitBreaker != nil {
+		if err := groupOption.CircuitBreaker.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if groupOption.RetryPolicy != nil {
+		retry, err := newRetryPolicy(groupOption.RetryPolicy)
+		if err != nil {
+			return nil, err
+		}
+		g.retry = retry
+	}
+
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+
 	g.masters = make(map[int]Pool, g.masterLen)
 	g.slaves = make(map[int]Pool, g.slaveLen)
+	g.masterNodes = make([]Node, 0, g.masterLen)
+	g.slaveNodes = make([]Node, 0, g.slaveLen)
+
+	var err error
+	if g.masterBalancer, err = newBalancer(groupOption.Balancer); err != nil {
+		return nil, err
+	}
+
+	if g.slaveBalancer, err = newBalancer(groupOption.Balancer); err != nil {
+		return nil, err
+	}
 
 	for index, _ := range groupOption.Masters {
-		pool, err := newMysqlPool(&groupOption.Masters[index])
+		mPool, err := newMysqlPool(&groupOption.Masters[index])
 		if err != nil {
 			return nil, err
 		}
 
+		pool := &groupPool{Pool: mPool, g: g, role: RoleMaster, index: index}
+
 		g.masters[index] = pool
 		g.masterBadPool[index] = &atomic.Int64{}
+		g.masterBreakers[index] = newBreaker(groupOption.CircuitBreaker, g.breakerNotifier(RoleMaster, index))
+		g.masterNodes = append(g.masterNodes, Node{Index: index, Weight: weight(groupOption.Masters[index].Weight), Pool: pool})
 	}
 
 	for index, _ := range groupOption.Slaves {
-		pool, err := newMysqlPool(&groupOption.Slaves[index])
+		mPool, err := newMysqlPool(&groupOption.Slaves[index])
 		if err != nil {
 			return nil, err
 		}
 
+		pool := &groupPool{Pool: mPool, g: g, role: RoleSlave, index: index}
+
 		g.slaves[index] = pool
 		g.slaveBadPool[index] = &atomic.Int64{}
+		g.slaveBreakers[index] = newBreaker(groupOption.CircuitBreaker, g.breakerNotifier(RoleSlave, index))
+		g.slaveLag[index] = &atomic.Int64{}
+		g.slaveNodes = append(g.slaveNodes, Node{Index: index, Weight: weight(groupOption.Slaves[index].Weight), Pool: pool})
+	}
+
+	if groupOption.ReplicationLag != nil {
+		g.maxLagMs = groupOption.ReplicationLag.MaxLag
+		if groupOption.ReplicationLag.Interval > 0 {
+			//首次检测前延迟未知
+			for _, lag := range g.slaveLag {
+				lag.Store(math.MaxInt64)
+			}
+
+			g.wg.Add(1)
+			go g.lagMonitor(groupOption.ReplicationLag)
+		}
+	}
+
+	if groupOption.HealthCheckInterval > 0 {
+		g.wg.Add(1)
+		go g.healthCheck(time.Duration(groupOption.HealthCheckInterval) * time.Second)
 	}
 
 	return g, nil
@@ -147,13 +328,19 @@ func (g *group) isBadConnError(index int, badTime int64, err error, master bool)
 		return false
 	}
 
-	if err == driver.ErrBadConn {
-		g.down(index, master)
-		return true
-	}
+	//连接错误，或主库被设置为只读（如发生主从切换）
+	kind, _ := classify(err)
+	if kind == ErrConnection || (master && kind == ErrReadOnly) {
+		role := RoleSlave
+		if master {
+			role = RoleMaster
+		}
 
-	if errVal, ok := err.(*net.OpError); ok {
-		log.Printf("exec sql error:%s", errVal.Error())
+		g.logger.Log(context.Background(), LevelError, `pool down`,
+			Field{Key: `role`, Value: role},
+			Field{Key: `index`, Value: index},
+			Field{Key: `error`, Value: err.Error()},
+		)
 		g.down(index, master)
 		return true
 	}
@@ -174,7 +361,10 @@ func (g *group) down(index int, isMaster bool) {
 		if g.masterBadPool[index].Load() > 0 {
 			return
 		}
-		g.masterBadPool[index].CAS(0, time.Now().Unix())
+
+		if g.masterBadPool[index].CAS(0, time.Now().Unix()) {
+			g.notify(RoleMaster, index, false)
+		}
 		return
 	}
 
@@ -185,7 +375,10 @@ func (g *group) down(index int, isMaster bool) {
 	if g.slaveBadPool[index].Load() > 0 {
 		return
 	}
-	g.slaveBadPool[index].CAS(0, time.Now().Unix())
+
+	if g.slaveBadPool[index].CAS(0, time.Now().Unix()) {
+		g.notify(RoleSlave, index, false)
+	}
 }
 
 func (g *group) up(index int, isMaster bool) {
@@ -193,93 +386,223 @@ func (g *group) up(index int, isMaster bool) {
 		if index >= g.masterLen {
 			return
 		}
-		g.masterBadPool[index].Store(0)
+
+		if g.masterBadPool[index].Swap(0) > 0 {
+			g.notify(RoleMaster, index, true)
+		}
 		return
 	}
 
 	if index >= g.slaveLen {
 		return
 	}
-	g.slaveBadPool[index].Store(0)
+
+	if g.slaveBadPool[index].Swap(0) > 0 {
+		g.notify(RoleSlave, index, true)
+	}
+}
+
+func weight(w int) int {
+	if w < 1 {
+		return 1
+	}
+	return w
 }
 
 func (g *group) getMaster() (index int, mPoll Pool, badTime int64) {
-	if g.masterLen == 1 {
-		return 0, g.masters[0], g.masterBadPool[0].Load()
+	var ok bool
+	if index, mPoll, badTime, ok = g.pick(g.masterNodes, g.masterBadPool, g.masterBreakers, g.masterBalancer, nil); ok || len(g.masterNodes) == 0 {
+		return
+	}
+
+	//所有主库均熔断时，没有其他选择，仍使用第一个主库
+	node := g.masterNodes[0]
+	return node.Index, node.Pool, g.masterBadPool[node.Index].Load()
+}
+
+// getSlave 选择从库，maxLag大于0时排除复制延迟超过maxLag(ms)的从库，无可用从库或均熔断时ok为false
+func (g *group) getSlave(maxLag int64) (index int, mPoll Pool, badTime int64, ok bool) {
+	if maxLag < 1 {
+		return g.pick(g.slaveNodes, g.slaveBadPool, g.slaveBreakers, g.slaveBalancer, nil)
 	}
 
-	current := time.Now().Unix()
-	for index, mPoll = range g.masters {
-		badTime = g.masterBadPool[index].Load()
-		if badTime == 0 {
-			return index, mPoll, badTime
+	return g.pick(g.slaveNodes, g.slaveBadPool, g.slaveBreakers, g.slaveBalancer, func(index int) bool {
+		return g.slaveLag[index].Load() <= maxLag
+	})
+}
+
+// pick 从可用的连接池中按负载均衡策略选择一个，超过RetryInterval的坏连接池也参与选择以便恢复，
+// 熔断中的连接池不参与选择，熔断超时后作为半开探测参与选择；均不可用时回退到未熔断的坏连接池，均熔断时ok为false
+func (g *group) pick(nodes []Node, badPool map[int]*atomic.Int64, breakers map[int]*breaker, balancer Balancer, accept func(index int) bool) (index int, mPoll Pool, badTime int64, ok bool) {
+	var (
+		now       = time.Now()
+		current   = now.Unix()
+		candidate = -1
+		available = make([]Node, 0, len(nodes))
+	)
+
+	for position, node := range nodes {
+		if accept != nil && !accept(node.Index) {
+			continue
+		}
+
+		if !breakers[node.Index].ready(now) {
+			continue
+		}
+
+		if candidate < 0 {
+			candidate = position
 		}
 
-		if badTime+g.retryInterval < current {
-			g.masterBadPool[index].Store(current)
-			return index, mPoll, badTime
+		badTime = badPool[node.Index].Load()
+		if badTime == 0 || badTime+g.retryInterval < current {
+			available = append(available, node)
 		}
 	}
 
-	return 0, g.masters[0], g.masterBadPool[0].Load()
-}
+	if candidate < 0 {
+		return 0, nil, 0, false
+	}
 
-func (g *group) getSlave() (index int, mPoll Pool, badTime int64) {
-	if g.slaveLen == 1 {
-		return 0, g.slaves[0], g.slaveBadPool[0].Load()
+	if len(available) == 0 {
+		//熔断超时的连接池同样需要获取探测许可，才能进入半开状态恢复
+		node := nodes[candidate]
+		if !breakers[node.Index].tryAcquire(now) {
+			return 0, nil, 0, false
+		}
+		return node.Index, node.Pool, badPool[node.Index].Load(), true
 	}
 
-	current := time.Now().Unix()
-	for index, mPoll = range g.slaves {
-		badTime = g.slaveBadPool[index].Load()
-		if badTime == 0 {
-			return index, mPoll, badTime
+	for len(available) > 0 {
+		selected := 0
+		if len(available) > 1 {
+			selected = balancer.Select(available)
+			if selected < 0 || selected >= len(available) {
+				selected = 0
+			}
+		}
+
+		//并发选择时探测许可可能已被占用，排除后重新选择
+		node := available[selected]
+		if !breakers[node.Index].tryAcquire(now) {
+			available = append(available[:selected], available[selected+1:]...)
+			continue
 		}
 
-		if badTime+g.retryInterval < current {
-			g.slaveBadPool[index].Store(current)
-			return index, mPoll, badTime
+		badTime = badPool[node.Index].Load()
+		if badTime > 0 {
+			badPool[node.Index].Store(current)
 		}
+
+		return node.Index, node.Pool, badTime, true
 	}
 
-	return 0, g.slaves[0], g.slaveBadPool[0].Load()
+	return 0, nil, 0, false
 }
 
-func (g *group) exec(handler func(mPool Pool) (sql.Result, error)) (result sql.Result, err error) {
+// exec 在主库执行，成功后标记ctx上的会话在StickyMaster时间内读主库，失败时按RetryPolicy重试
+func (g *group) exec(ctx context.Context, handler func(mPool Pool) (sql.Result, error)) (result sql.Result, err error) {
+	idempotent := idempotentFrom(ctx)
+
+	for attempt := 1; ; attempt++ {
+		var cause error
+		result, err, cause = g.execOnce(ctx, handler)
+		if err == nil || !g.retry.retryable(attempt, cause, idempotent) || !g.retry.wait(ctx, attempt) {
+			return result, err
+		}
+	}
+}
+
+// execOnce 依次尝试主库，cause为最后一次执行的原始错误
+//
+// 语句可能已发送到服务端的连接错误（如读取响应失败）仅在WithIdempotent标记时切换到下一个主库，避免重复写入
+func (g *group) execOnce(ctx context.Context, handler func(mPool Pool) (sql.Result, error)) (result sql.Result, err error, cause error) {
+	idempotent := idempotentFrom(ctx)
+
 	for start := 0; start < g.masterLen; start++ {
 		index, pool, badTime := g.getMaster()
-		result, err = handler(pool)
-		if g.isBadConnError(index, badTime, err, true) {
+		result, cause = handler(pool)
+		//只读错误说明服务端拒绝了写入，可以安全切换
+		if g.isBadConnError(index, badTime, cause, true) && (idempotent || notSent(cause) || ErrorKind(cause) == ErrReadOnly) {
 			continue
 		}
-		return result, err
+
+		if cause == nil {
+			g.stick(ctx)
+		}
+		return result, wrapError(cause), cause
+	}
+	return nil, ErrNoMasterConn, cause
+}
+
+// query 查询，所有从库复制延迟超过阈值时回退到主库，失败时按RetryPolicy重试
+func (g *group) query(ctx context.Context, handler func(mPool Pool) (*sql.Rows, error), useMaster bool) (rows *sql.Rows, err error) {
+	for attempt := 1; ; attempt++ {
+		var cause error
+		rows, err, cause = g.queryOnce(ctx, handler, useMaster)
+		if err == nil || !g.retry.retryable(attempt, cause, true) || !g.retry.wait(ctx, attempt) {
+			return rows, err
+		}
 	}
-	return nil, ErrNoMasterConn
 }
 
-func (g *group) query(handler func(mPool Pool) (*sql.Rows, error), useMaster bool) (rows *sql.Rows, err error) {
-	var funcPool = g.getSlave
+// queryOnce 依次尝试从库或主库，cause为最后一次执行的原始错误
+func (g *group) queryOnce(ctx context.Context, handler func(mPool Pool) (*sql.Rows, error), useMaster bool) (rows *sql.Rows, err error, cause error) {
+	var (
+		index    int
+		pool     Pool
+		badTime  int64
+		ok       bool
+		maxLag   = g.maxLag(ctx)
+		attempts = g.slaveLen
+	)
+
+	useMaster = useMaster || g.sticky(ctx)
+
 	if useMaster {
-		funcPool = g.getMaster
+		attempts = g.masterLen
 	}
 
-	for start := 0; start < g.slaveLen; start++ {
-		index, pool, badTime := funcPool()
-		rows, err = handler(pool)
-		if g.isBadConnError(index, badTime, err, useMaster) {
+	for start := 0; start < attempts; start++ {
+		isMaster := useMaster
+		if !isMaster {
+			if index, pool, badTime, ok = g.getSlave(maxLag); !ok {
+				isMaster = true
+			}
+		}
+
+		if isMaster {
+			index, pool, badTime = g.getMaster()
+		}
+
+		rows, cause = handler(pool)
+		if g.isBadConnError(index, badTime, cause, isMaster) {
 			continue
 		}
-		return rows, err
+		return rows, wrapError(cause), cause
 	}
 
-	return nil, ErrNoSlaveConn
+	if useMaster {
+		return nil, ErrNoMasterConn, cause
+	}
+	return nil, ErrNoSlaveConn, cause
+}
+
+func (g *group) queryContext(ctx context.Context, useMaster bool, sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.queryContext(ctx, useMaster, sqlStr, args...)
+	}
+
+	return g.query(ctx, func(mPool Pool) (*sql.Rows, error) {
+		return mPool.QueryContext(ctx, sqlStr, args...)
+	}, useMaster)
 }
 
 func (g *group) BadPool(isMaster bool) (list []int) {
 	if isMaster {
 		list = make([]int, 0, g.masterLen)
 		for index := 0; index < g.masterLen; index++ {
-			if g.masterBadPool[index].Load() > 0 {
+			if g.masterBadPool[index].Load() > 0 || g.masterBreakers[index].State() != BreakerClosed {
 				list = append(list, index)
 			}
 		}
@@ -288,19 +611,104 @@ func (g *group) BadPool(isMaster bool) (list []int) {
 
 	list = make([]int, 0, g.slaveLen)
 	for index := 0; index < g.slaveLen; index++ {
-		if g.slaveBadPool[index].Load() > 0 {
+		if g.slaveBadPool[index].Load() > 0 || g.slaveBreakers[index].State() != BreakerClosed {
 			list = append(list, index)
 		}
 	}
 	return
 }
 
+func (g *group) Ping(ctx context.Context) (err error) {
+	for index := 0; index < g.masterLen; index++ {
+		if pingErr := g.ping(ctx, index, true); pingErr != nil && err == nil {
+			err = pingErr
+		}
+	}
+
+	for index := 0; index < g.slaveLen; index++ {
+		if pingErr := g.ping(ctx, index, false); pingErr != nil && err == nil {
+			err = pingErr
+		}
+	}
+
+	return
+}
+
+func (g *group) ping(ctx context.Context, index int, isMaster bool) (err error) {
+	var (
+		pool = g.slaves[index]
+		role = RoleSlave
+	)
+
+	if isMaster {
+		pool = g.masters[index]
+		role = RoleMaster
+	}
+
+	if err = pool.Ping(ctx); err != nil {
+		g.down(index, isMaster)
+		return fmt.Errorf("mysql group: ping %s[%d] failed: %w", role, index, err)
+	}
+
+	g.up(index, isMaster)
+	return nil
+}
+
+func (g *group) Stats() (list []PoolStats) {
+	list = make([]PoolStats, 0, g.masterLen+g.slaveLen)
+	for index := 0; index < g.masterLen; index++ {
+		badTime, state := g.masterBadPool[index].Load(), g.masterBreakers[index].State()
+		list = append(list, PoolStats{
+			Role:    RoleMaster,
+			Index:   index,
+			Bad:     badTime > 0 || state != BreakerClosed,
+			BadTime: badTime,
+			Breaker: state,
+			Stats:   g.masters[index].Stats(),
+		})
+	}
+
+	for index := 0; index < g.slaveLen; index++ {
+		badTime, state := g.slaveBadPool[index].Load(), g.slaveBreakers[index].State()
+		list = append(list, PoolStats{
+			Role:    RoleSlave,
+			Index:   index,
+			Bad:     badTime > 0 || state != BreakerClosed,
+			BadTime: badTime,
+			Breaker: state,
+			Lag:     g.slaveLag[index].Load(),
+			Stats:   g.slaves[index].Stats(),
+		})
+	}
+
+	return
+}
+
+func (g *group) Close() (err error) {
+	g.cancel()
+	g.wg.Wait()
+
+	for index := 0; index < g.masterLen; index++ {
+		if closeErr := g.masters[index].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	for index := 0; index < g.slaveLen; index++ {
+		if closeErr := g.slaves[index].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return
+}
+
 func (g *group) Query(useMaster bool, sqlStr string, args ...interface{}) (rows []map[string]string, err error) {
 	var (
 		sqlRows *sql.Rows
 	)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(context.Background(), func(mPool Pool) (*sql.Rows, error) {
 		return mPool.Query(sqlStr, args...)
 	}, useMaster)
 
@@ -312,11 +720,15 @@ func (g *group) Query(useMaster bool, sqlStr string, args ...interface{}) (rows
 }
 
 func (g *group) QueryContext(ctx context.Context, useMaster bool, sqlStr string, args ...interface{}) (rows []map[string]string, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.QueryContext(ctx, sqlStr, args...)
+	}
+
 	var (
 		sqlRows *sql.Rows
 	)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(ctx, func(mPool Pool) (*sql.Rows, error) {
 		return mPool.QueryContext(ctx, sqlStr, args...)
 	}, useMaster)
 
@@ -328,13 +740,17 @@ func (g *group) QueryContext(ctx context.Context, useMaster bool, sqlStr string,
 }
 
 func (g *group) Exec(sqlStr string, args ...interface{}) (result sql.Result, err error) {
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	return g.exec(context.Background(), func(mPool Pool) (sql.Result, error) {
 		return mPool.Exec(sqlStr, args...)
 	})
 }
 
 func (g *group) ExecContext(ctx context.Context, sqlStr string, args ...interface{}) (result sql.Result, err error) {
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.ExecContext(ctx, sqlStr, args...)
+	}
+
+	return g.exec(ctx, func(mPool Pool) (sql.Result, error) {
 		return mPool.ExecContext(ctx, sqlStr, args...)
 	})
 }
@@ -348,12 +764,22 @@ func (g *group) InsertObj(obj interface{}) (result sql.Result, err error) {
 		return nil, err
 	}
 
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	result, err = g.exec(context.Background(), func(mPool Pool) (sql.Result, error) {
 		return mPool.Exec(sqlStr, args...)
 	})
+
+	if err != nil || !g.fillInsertId {
+		return
+	}
+
+	return result, fillInsertId(obj, result)
 }
 
 func (g *group) InsertObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.InsertObjContext(ctx, obj)
+	}
+
 	args := base.AcquireArgs()
 	defer base.ReleaseArgs(&args)
 
@@ -362,9 +788,15 @@ func (g *group) InsertObjContext(ctx context.Context, obj interface{}) (result s
 		return nil, err
 	}
 
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	result, err = g.exec(ctx, func(mPool Pool) (sql.Result, error) {
 		return mPool.ExecContext(ctx, sqlStr, args...)
 	})
+
+	if err != nil || !g.fillInsertId {
+		return
+	}
+
+	return result, fillInsertId(obj, result)
 }
 
 func (g *group) DeleteObj(obj interface{}) (result sql.Result, err error) {
@@ -376,12 +808,16 @@ func (g *group) DeleteObj(obj interface{}) (result sql.Result, err error) {
 		return nil, err
 	}
 
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	return g.exec(context.Background(), func(mPool Pool) (sql.Result, error) {
 		return mPool.Exec(sqlStr, args...)
 	})
 }
 
 func (g *group) DeleteObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.DeleteObjContext(ctx, obj)
+	}
+
 	args := base.AcquireArgs()
 	defer base.ReleaseArgs(&args)
 
@@ -390,7 +826,7 @@ func (g *group) DeleteObjContext(ctx context.Context, obj interface{}) (result s
 		return nil, err
 	}
 
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	return g.exec(ctx, func(mPool Pool) (sql.Result, error) {
 		return mPool.ExecContext(ctx, sqlStr, args...)
 	})
 }
@@ -404,12 +840,16 @@ func (g *group) UpdateObj(obj interface{}) (result sql.Result, err error) {
 		return nil, err
 	}
 
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	return g.exec(context.Background(), func(mPool Pool) (sql.Result, error) {
 		return mPool.Exec(sqlStr, args...)
 	})
 }
 
 func (g *group) UpdateObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.UpdateObjContext(ctx, obj)
+	}
+
 	args := base.AcquireArgs()
 	defer base.ReleaseArgs(&args)
 
@@ -418,7 +858,7 @@ func (g *group) UpdateObjContext(ctx context.Context, obj interface{}) (result s
 		return nil, err
 	}
 
-	return g.exec(func(mPool Pool) (sql.Result, error) {
+	return g.exec(ctx, func(mPool Pool) (sql.Result, error) {
 		return mPool.ExecContext(ctx, sqlStr, args...)
 	})
 }
@@ -433,7 +873,7 @@ func (g *group) Find(query Query, useMaster bool) (rows []map[string]string, err
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(context.Background(), func(mPool Pool) (*sql.Rows, error) {
 		return mPool.Query(sqlStr, args...)
 	}, useMaster)
 
@@ -445,6 +885,10 @@ func (g *group) Find(query Query, useMaster bool) (rows []map[string]string, err
 }
 
 func (g *group) FindContext(ctx context.Context, query Query, useMaster bool) (rows []map[string]string, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.FindContext(ctx, query)
+	}
+
 	var (
 		sqlRows *sql.Rows
 
@@ -454,7 +898,7 @@ func (g *group) FindContext(ctx context.Context, query Query, useMaster bool) (r
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(ctx, func(mPool Pool) (*sql.Rows, error) {
 		return mPool.QueryContext(ctx, sqlStr, args...)
 	}, useMaster)
 
@@ -475,7 +919,7 @@ func (g *group) FindAll(query Query, obj interface{}, useMaster bool) (objList [
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(context.Background(), func(mPool Pool) (*sql.Rows, error) {
 		return mPool.Query(sqlStr, args...)
 	}, useMaster)
 
@@ -487,6 +931,10 @@ func (g *group) FindAll(query Query, obj interface{}, useMaster bool) (objList [
 }
 
 func (g *group) FindAllContext(ctx context.Context, query Query, obj interface{}, useMaster bool) (objList []interface{}, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.FindAllContext(ctx, query, obj)
+	}
+
 	var (
 		sqlRows *sql.Rows
 
@@ -496,7 +944,7 @@ func (g *group) FindAllContext(ctx context.Context, query Query, obj interface{}
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	sqlRows, err = g.query(ctx, func(mPool Pool) (*sql.Rows, error) {
 		return mPool.QueryContext(ctx, sqlStr, args...)
 	}, useMaster)
 
@@ -521,7 +969,7 @@ func (g *group) FindOne(table string, where Where, useMaster bool) (row map[stri
 		query.Close()
 	}()
 
-	rows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	rows, err = g.query(context.Background(), func(mPool Pool) (*sql.Rows, error) {
 		return mPool.Query(sqlStr, args...)
 	}, useMaster)
 
@@ -541,6 +989,10 @@ func (g *group) FindOne(table string, where Where, useMaster bool) (row map[stri
 }
 
 func (g *group) FindOneContext(ctx context.Context, table string, where Where, useMaster bool) (row map[string]string, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.FindOneContext(ctx, table, where)
+	}
+
 	var (
 		rows *sql.Rows
 
@@ -554,7 +1006,7 @@ func (g *group) FindOneContext(ctx context.Context, table string, where Where, u
 		query.Close()
 	}()
 
-	rows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	rows, err = g.query(ctx, func(mPool Pool) (*sql.Rows, error) {
 		return mPool.QueryContext(ctx, sqlStr, args...)
 	}, useMaster)
 
@@ -586,7 +1038,7 @@ func (g *group) FindOneObj(where Where, obj interface{}, useMaster bool) (err er
 		return err
 	}
 
-	rows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	rows, err = g.query(context.Background(), func(mPool Pool) (*sql.Rows, error) {
 		return mPool.Query(sqlStr, args...)
 	}, useMaster)
 
@@ -597,6 +1049,10 @@ func (g *group) FindOneObj(where Where, obj interface{}, useMaster bool) (err er
 }
 
 func (g *group) FindOneObjContext(ctx context.Context, where Where, obj interface{}, useMaster bool) (err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.FindOneObjContext(ctx, where, obj)
+	}
+
 	var (
 		args = base.AcquireArgs()
 		rows *sql.Rows
@@ -609,7 +1065,7 @@ func (g *group) FindOneObjContext(ctx context.Context, where Where, obj interfac
 		return err
 	}
 
-	rows, err = g.query(func(mPool Pool) (*sql.Rows, error) {
+	rows, err = g.query(ctx, func(mPool Pool) (*sql.Rows, error) {
 		return mPool.QueryContext(ctx, sqlStr, args...)
 	}, useMaster)
 
@@ -630,6 +1086,10 @@ func (g *group) Insert(table string, rows ...Row) (result sql.Result, err error)
 }
 
 func (g *group) InsertContext(ctx context.Context, table string, rows ...Row) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.InsertContext(ctx, table, rows...)
+	}
+
 	var (
 		args   = base.AcquireArgs()
 		sqlStr = SqlInsert(&args, table, rows...)
@@ -639,6 +1099,58 @@ func (g *group) InsertContext(ctx context.Context, table string, rows ...Row) (r
 	return g.ExecContext(ctx, sqlStr, args...)
 }
 
+func (g *group) Upsert(table string, option *UpsertOption, rows ...Row) (result sql.Result, err error) {
+	var (
+		args   = base.AcquireArgs()
+		sqlStr = SqlUpsert(&args, table, option, rows...)
+	)
+	defer base.ReleaseArgs(&args)
+
+	return g.Exec(sqlStr, args...)
+}
+
+func (g *group) UpsertContext(ctx context.Context, table string, option *UpsertOption, rows ...Row) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.UpsertContext(ctx, table, option, rows...)
+	}
+
+	var (
+		args   = base.AcquireArgs()
+		sqlStr = SqlUpsert(&args, table, option, rows...)
+	)
+	defer base.ReleaseArgs(&args)
+
+	return g.ExecContext(ctx, sqlStr, args...)
+}
+
+func (g *group) UpsertObj(option *UpsertOption, obj interface{}) (result sql.Result, err error) {
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sqlStr, err := SqlUpsertObjs(&args, option, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.Exec(sqlStr, args...)
+}
+
+func (g *group) UpsertObjContext(ctx context.Context, option *UpsertOption, obj interface{}) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.UpsertObjContext(ctx, option, obj)
+	}
+
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sqlStr, err := SqlUpsertObjs(&args, option, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.ExecContext(ctx, sqlStr, args...)
+}
+
 func (g *group) DeleteAll(table string, where Where) (result sql.Result, err error) {
 	var (
 		args   = base.AcquireArgs()
@@ -650,6 +1162,10 @@ func (g *group) DeleteAll(table string, where Where) (result sql.Result, err err
 }
 
 func (g *group) DeleteAllContext(ctx context.Context, table string, where Where) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.DeleteAllContext(ctx, table, where)
+	}
+
 	var (
 		args   = base.AcquireArgs()
 		sqlStr = SqlDelete(&args, table, where)
@@ -670,6 +1186,10 @@ func (g *group) UpdateAll(table string, set Row, where Where) (result sql.Result
 }
 
 func (g *group) UpdateAllContext(ctx context.Context, table string, set Row, where Where) (result sql.Result, err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.UpdateAllContext(ctx, table, set, where)
+	}
+
 	var (
 		args   = base.AcquireArgs()
 		sqlStr = SqlUpdate(&args, table, set, where)
@@ -679,6 +1199,30 @@ func (g *group) UpdateAllContext(ctx context.Context, table string, set Row, whe
 	return g.ExecContext(ctx, sqlStr, args...)
 }
 
+func (g *group) Increment(table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return g.UpdateAll(table, Row{field: Expr(field+"+?", delta)}, where)
+}
+
+func (g *group) IncrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return g.UpdateAllContext(ctx, table, Row{field: Expr(field+"+?", delta)}, where)
+}
+
+func (g *group) Decrement(table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return g.UpdateAll(table, Row{field: Expr(field+"-?", delta)}, where)
+}
+
+func (g *group) DecrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return g.UpdateAllContext(ctx, table, Row{field: Expr(field+"-?", delta)}, where)
+}
+
+// attach 将group配置应用到事务
+func (g *group) attach(tx Transaction) Transaction {
+	if t, ok := tx.(*transaction); ok {
+		t.fillInsertId = g.fillInsertId
+	}
+	return tx
+}
+
 func (g *group) Begin() (Transaction, error) {
 	for start := 0; start < g.masterLen; start++ {
 		index, pool, badTime := g.getMaster()
@@ -686,7 +1230,7 @@ func (g *group) Begin() (Transaction, error) {
 		if g.isBadConnError(index, badTime, err, true) {
 			continue
 		}
-		return tx, err
+		return g.attach(tx), wrapError(err)
 	}
 	return nil, ErrNoMasterConn
 }
@@ -698,7 +1242,72 @@ func (g *group) BeginTx(ctx context.Context, opts *sql.TxOptions) (Transaction,
 		if g.isBadConnError(index, badTime, err, true) {
 			continue
 		}
-		return tx, err
+		return g.attach(tx), wrapError(err)
 	}
 	return nil, ErrNoMasterConn
 }
+
+func (g *group) Transaction(ctx context.Context, opts *sql.TxOptions, handler func(tx Transaction) error) (err error) {
+	return g.TransactionContext(ctx, opts, func(ctx context.Context, tx Transaction) error {
+		return handler(tx)
+	})
+}
+
+func (g *group) TransactionContext(ctx context.Context, opts *sql.TxOptions, handler func(ctx context.Context, tx Transaction) error) (err error) {
+	if tx, ok := g.txFrom(ctx); ok {
+		return tx.Transaction(func(tx Transaction) error {
+			return handler(ctx, tx)
+		})
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = g.transaction(ctx, opts, handler)
+		if err == nil {
+			g.stick(ctx)
+			return nil
+		}
+
+		if attempt >= g.txRetry || !isRetryableTxError(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+func (g *group) transaction(ctx context.Context, opts *sql.TxOptions, handler func(ctx context.Context, tx Transaction) error) (err error) {
+	tx, err := g.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err = handler(WithTransaction(ctx, tx), tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// txFrom 获取ctx上绑定的事务，其他Group开启的事务被忽略，避免语句在其他数据库上执行
+func (g *group) txFrom(ctx context.Context) (tx Transaction, ok bool) {
+	if tx, ok = TransactionFrom(ctx); !ok {
+		return nil, false
+	}
+
+	if t, isTx := tx.(*transaction); isTx && t.group != g {
+		return nil, false
+	}
+	return tx, true
+}
+
+// isRetryableTxError 死锁或锁等待超时
+func isRetryableTxError(err error) bool {
+	kind, _ := classify(err)
+	return kind == ErrDeadlock || kind == ErrLockTimeout
+}
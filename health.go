@@ -0,0 +1,68 @@
+package orm
+
+import (
+	"context"
+	"time"
+)
+
+// StateEvent 连接池状态变化事件
+type StateEvent struct {
+	Role  string    `json:"role"`
+	Index int       `json:"index"`
+	Up    bool      `json:"up"`
+	Time  time.Time `json:"time"`
+}
+
+// StateObserver 连接池状态变化观察者
+type StateObserver func(event StateEvent)
+
+func (g *group) OnStateChange(observer StateObserver) {
+	if observer == nil {
+		return
+	}
+
+	g.observerMutex.Lock()
+	defer g.observerMutex.Unlock()
+
+	g.observers = append(g.observers, observer)
+}
+
+func (g *group) notify(role string, index int, up bool) {
+	g.observerMutex.RLock()
+	observers := g.observers
+	g.observerMutex.RUnlock()
+
+	if len(observers) == 0 {
+		return
+	}
+
+	event := StateEvent{
+		Role:  role,
+		Index: index,
+		Up:    up,
+		Time:  time.Now(),
+	}
+
+	for _, observer := range observers {
+		observer(event)
+	}
+}
+
+// healthCheck 定时检查所有连接池，主动标记不可用与恢复，Close时退出
+func (g *group) healthCheck(interval time.Duration) {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(g.ctx, interval)
+			_ = g.Ping(ctx)
+			cancel()
+		}
+	}
+}
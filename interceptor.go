@@ -0,0 +1,95 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Operation 语句类型
+type Operation string
+
+const (
+	OpQuery    Operation = `query`
+	OpExec     Operation = `exec`
+	OpBegin    Operation = `begin`
+	OpCommit   Operation = `commit`
+	OpRollback Operation = `rollback`
+)
+
+// Statement 拦截器中的语句，拦截器可修改Sql、Args和TxOptions后调用invoker
+type Statement struct {
+	Op   Operation
+	Sql  string
+	Args []interface{}
+	// TxOptions 仅OpBegin有效
+	TxOptions *sql.TxOptions
+	// Role 目标连接池角色，RoleMaster或RoleSlave
+	Role string
+	// Index 目标连接池序号
+	Index int
+	// Pool 目标连接池
+	Pool Pool
+	// Tx 语句所在事务，不在事务中为nil
+	Tx Transaction
+}
+
+// Reply 语句执行结果，OpQuery为Rows，OpExec为Result，OpBegin为Tx
+type Reply struct {
+	Rows   *sql.Rows
+	Result sql.Result
+	Tx     Transaction
+}
+
+// Invoker 执行语句
+type Invoker func(ctx context.Context, stmt *Statement) (reply *Reply, err error)
+
+// Interceptor 拦截器，调用invoker继续执行，不调用时直接返回reply和err
+type Interceptor func(ctx context.Context, stmt *Statement, invoker Invoker) (reply *Reply, err error)
+
+// Use 注册拦截器，按注册顺序由外到内执行，对事务内的语句同样生效
+func (g *group) Use(interceptors ...Interceptor) {
+	g.interceptorMutex.Lock()
+	defer g.interceptorMutex.Unlock()
+
+	chain := make([]Interceptor, 0, len(g.interceptors)+len(interceptors))
+	chain = append(chain, g.interceptors...)
+	for _, interceptor := range interceptors {
+		if interceptor != nil {
+			chain = append(chain, interceptor)
+		}
+	}
+	g.interceptors = chain
+}
+
+// invoke 经过拦截器链执行语句
+func (g *group) invoke(ctx context.Context, stmt *Statement, final Invoker) (reply *Reply, err error) {
+	g.interceptorMutex.RLock()
+	interceptors := g.interceptors
+	g.interceptorMutex.RUnlock()
+
+	invoker := final
+	for index := len(interceptors) - 1; index >= 0; index-- {
+		interceptor, next := interceptors[index], invoker
+		invoker = func(ctx context.Context, stmt *Statement) (*Reply, error) {
+			return interceptor(ctx, stmt, next)
+		}
+	}
+
+	reply, err = invoker(ctx, stmt)
+	if reply == nil {
+		reply = &Reply{}
+	}
+
+	if err != nil {
+		return reply, err
+	}
+
+	//拦截器短路时须返回与语句类型对应的结果
+	switch {
+	case stmt.Op == OpQuery && reply.Rows == nil,
+		stmt.Op == OpExec && reply.Result == nil,
+		stmt.Op == OpBegin && reply.Tx == nil:
+		return reply, ErrEmptyReply
+	}
+	return reply, nil
+}
@@ -0,0 +1,231 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidHeartbeat = errors.New(`mysql group: invalid heartbeatTable or heartbeatColumn, only letters, digits, underscores and db.table are allowed`)
+)
+
+// LagOption 从库复制延迟监控配置
+type LagOption struct {
+	//检测间隔，单位s
+	Interval int64 `yaml:"interval" json:"interval"`
+	//默认可接受的最大复制延迟，单位ms，0为不限制
+	MaxLag int64 `yaml:"maxLag" json:"maxLag"`
+	//心跳表，支持db.table，为空时使用SHOW REPLICA STATUS
+	HeartbeatTable string `yaml:"heartbeatTable" json:"heartbeatTable"`
+	//心跳表时间列，默认ts
+	HeartbeatColumn string `yaml:"heartbeatColumn" json:"heartbeatColumn"`
+}
+
+// validate 校验检测间隔、最大延迟以及心跳表和列名
+func (lo *LagOption) validate() error {
+	if lo.Interval < 0 || lo.MaxLag < 0 {
+		return ErrInvalidOption
+	}
+
+	if lo.HeartbeatTable == "" {
+		return nil
+	}
+
+	if _, ok := quoteIdentifier(lo.HeartbeatTable); !ok {
+		return ErrInvalidHeartbeat
+	}
+
+	if lo.HeartbeatColumn != "" && !isIdentifier(lo.HeartbeatColumn) {
+		return ErrInvalidHeartbeat
+	}
+	return nil
+}
+
+// quoteIdentifier 为table或db.table加反引号
+func quoteIdentifier(name string) (quoted string, ok bool) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", false
+	}
+
+	for index, part := range parts {
+		if !isIdentifier(part) {
+			return "", false
+		}
+		parts[index] = "`" + part + "`"
+	}
+	return strings.Join(parts, "."), true
+}
+
+// lagMonitor 启动后立即检测一次，之后定时检测所有从库的复制延迟，Close时退出
+//
+// 首次检测成功前从库延迟为未知(math.MaxInt64)，设置了MaxLag的查询不会选择该从库
+func (g *group) lagMonitor(option *LagOption) {
+	defer g.wg.Done()
+
+	interval := time.Duration(option.Interval) * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	probes := make(map[int]*lagProbe, len(g.slaves))
+	for index, pool := range g.slaves {
+		probes[index] = newLagProbe(pool, option)
+	}
+
+	for {
+		for index, probe := range probes {
+			ctx, cancel := context.WithTimeout(g.ctx, interval)
+			lag, err := probe.lag(ctx)
+			cancel()
+
+			//检测失败时保留上次的值
+			if err == nil {
+				g.slaveLag[index].Store(lag)
+			}
+		}
+
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lagProbe 单个从库的复制延迟检测
+type lagProbe struct {
+	//底层连接池，检测语句不经过拦截器、日志和熔断统计
+	pool Pool
+	//心跳表查询语句，为空时查询复制状态
+	heartbeatSql string
+	//首次成功后记录可用的状态查询语句
+	statusSql string
+}
+
+func newLagProbe(pool Pool, option *LagOption) *lagProbe {
+	if gp, ok := pool.(*groupPool); ok {
+		pool = gp.Pool
+	}
+
+	lp := &lagProbe{pool: pool}
+	if table, ok := quoteIdentifier(option.HeartbeatTable); ok && option.HeartbeatTable != "" {
+		column := option.HeartbeatColumn
+		if column == "" {
+			column = `ts`
+		}
+		lp.heartbeatSql = "SELECT TIMESTAMPDIFF(MICROSECOND, MAX(`" + column + "`), NOW(6)) FROM " + table
+	}
+	return lp
+}
+
+// lag 获取从库复制延迟，单位ms，复制已停止时返回math.MaxInt64
+func (lp *lagProbe) lag(ctx context.Context) (lag int64, err error) {
+	if lp.heartbeatSql != "" {
+		return heartbeatLag(ctx, lp.pool, lp.heartbeatSql)
+	}
+
+	rows, err := lp.status(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	status, err := firstRow(rows)
+	if err != nil || status == nil {
+		//非从库
+		return 0, err
+	}
+
+	for _, field := range []string{`Seconds_Behind_Source`, `Seconds_Behind_Master`} {
+		value, exists := status[field]
+		if !exists {
+			continue
+		}
+
+		if !value.Valid {
+			return math.MaxInt64, nil
+		}
+
+		seconds, err := strconv.ParseInt(value.String, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return seconds * 1000, nil
+	}
+
+	return 0, nil
+}
+
+// status 查询复制状态，SHOW REPLICA STATUS失败时尝试SHOW SLAVE STATUS(MySQL 8.0.22以下版本)
+func (lp *lagProbe) status(ctx context.Context) (rows *sql.Rows, err error) {
+	if lp.statusSql != "" {
+		return lp.pool.QueryContext(ctx, lp.statusSql)
+	}
+
+	for _, sqlStr := range []string{`SHOW REPLICA STATUS`, `SHOW SLAVE STATUS`} {
+		if rows, err = lp.pool.QueryContext(ctx, sqlStr); err == nil {
+			lp.statusSql = sqlStr
+			return rows, nil
+		}
+	}
+	return nil, err
+}
+
+func heartbeatLag(ctx context.Context, pool Pool, sqlStr string) (lag int64, err error) {
+	var micro sql.NullInt64
+	rows, err := pool.QueryContext(ctx, sqlStr)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	if err = rows.Scan(&micro); err != nil {
+		return 0, err
+	}
+
+	if !micro.Valid {
+		return math.MaxInt64, nil
+	}
+
+	if micro.Int64 < 0 {
+		return 0, nil
+	}
+	return micro.Int64 / 1000, nil
+}
+
+// firstRow 读取第一行，区分NULL与空值，无数据时返回nil
+func firstRow(rows *sql.Rows) (row map[string]sql.NullString, err error) {
+	fields, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	values := make([]sql.NullString, len(fields))
+	dests := make([]interface{}, len(fields))
+	for index := range values {
+		dests[index] = &values[index]
+	}
+
+	if err = rows.Scan(dests...); err != nil {
+		return nil, err
+	}
+
+	row = make(map[string]sql.NullString, len(fields))
+	for index, field := range fields {
+		row[field] = values[index]
+	}
+	return row, nil
+}
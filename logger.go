@@ -0,0 +1,132 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Level 日志级别
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String 级别名称
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return `DEBUG`
+	case LevelInfo:
+		return `INFO`
+	case LevelWarn:
+		return `WARN`
+	case LevelError:
+		return `ERROR`
+	}
+	return `UNKNOWN`
+}
+
+// Field 日志字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger 日志接口
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// LevelEnabler Logger可选实现，返回false时跳过该级别日志字段的构建
+type LevelEnabler interface {
+	Enabled(level Level) bool
+}
+
+// NewStdLogger 基于标准库log的Logger，低于level的日志不输出
+func NewStdLogger(level Level) Logger {
+	return &stdLogger{level: level}
+}
+
+type stdLogger struct {
+	level Level
+}
+
+// Enabled 实现LevelEnabler
+func (sl *stdLogger) Enabled(level Level) bool {
+	return level >= sl.level
+}
+
+func (sl *stdLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	if !sl.Enabled(level) {
+		return
+	}
+
+	var buf strings.Builder
+	buf.WriteByte('[')
+	buf.WriteString(level.String())
+	buf.WriteString("] ")
+	buf.WriteString(msg)
+
+	for _, field := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(field.Key)
+		buf.WriteByte('=')
+		buf.WriteString(fmt.Sprint(field.Value))
+	}
+
+	log.Print(buf.String())
+}
+
+// logStatement 记录语句日志，出错为Warn级别，超过慢查询阈值为Warn级别，其他为Debug级别
+func (g *group) logStatement(ctx context.Context, role string, index int, sqlStr string, args []interface{}, start time.Time, result sql.Result, err error) {
+	var (
+		duration = time.Since(start)
+		level    = LevelDebug
+		msg      = `sql`
+	)
+
+	if err != nil {
+		level, msg = LevelWarn, `sql error`
+	} else if g.slowThreshold > 0 && duration >= g.slowThreshold {
+		level, msg = LevelWarn, `slow sql`
+	}
+
+	if enabler, ok := g.logger.(LevelEnabler); ok && !enabler.Enabled(level) {
+		return
+	}
+
+	fields := make([]Field, 0, 7)
+	fields = append(fields,
+		Field{Key: `role`, Value: role},
+		Field{Key: `index`, Value: index},
+		Field{Key: `sql`, Value: sqlStr},
+	)
+
+	if g.redactArgs {
+		fields = append(fields, Field{Key: `args`, Value: fmt.Sprintf("[%d redacted]", len(args))})
+	} else {
+		fields = append(fields, Field{Key: `args`, Value: args})
+	}
+
+	fields = append(fields, Field{Key: `duration`, Value: duration})
+
+	if result != nil && err == nil {
+		if rows, e := result.RowsAffected(); e == nil {
+			fields = append(fields, Field{Key: `rows`, Value: rows})
+		}
+	}
+
+	if err != nil {
+		fields = append(fields, Field{Key: `error`, Value: err.Error()})
+	}
+
+	g.logger.Log(ctx, level, msg, fields...)
+}
@@ -0,0 +1,225 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grpc-boot/base"
+)
+
+// 配置格式
+const (
+	FormatYaml = `yaml`
+	FormatJson = `json`
+)
+
+var (
+	ErrNoMasters            = errors.New(`mysql group: at least one master is required`)
+	ErrEmptyDsn             = errors.New(`mysql group: dsn is empty`)
+	ErrInvalidRetryInterval = errors.New(`mysql group: retryInterval must not be negative`)
+	ErrInvalidOption        = errors.New(`mysql group: option is out of range`)
+	ErrInvalidFormat        = errors.New(`mysql group: only yaml and json formats are supported`)
+	ErrGroupNotFound        = errors.New(`mysql group: group not found`)
+	ErrManagerClosed        = errors.New(`mysql group: manager is closed`)
+)
+
+// Validate 校验配置
+func (groupOption *GroupOption) Validate() error {
+	if len(groupOption.Masters) == 0 {
+		return ErrNoMasters
+	}
+
+	if groupOption.RetryInterval < 0 {
+		return ErrInvalidRetryInterval
+	}
+
+	if groupOption.TransactionRetry < 0 || groupOption.HealthCheckInterval < 0 ||
+		groupOption.StickyMaster < 0 || groupOption.SlowThreshold < 0 {
+		return ErrInvalidOption
+	}
+
+	for index, poolOption := range groupOption.Masters {
+		if err := poolOption.Validate(); err != nil {
+			return fmt.Errorf("%s %d: %w", RoleMaster, index, err)
+		}
+	}
+
+	for index, poolOption := range groupOption.Slaves {
+		if err := poolOption.Validate(); err != nil {
+			return fmt.Errorf("%s %d: %w", RoleSlave, index, err)
+		}
+	}
+
+	if _, err := newBalancer(groupOption.Balancer); err != nil {
+		return err
+	}
+
+	if groupOption.ReplicationLag != nil {
+		if err := groupOption.ReplicationLag.validate(); err != nil {
+			return err
+		}
+	}
+
+	if groupOption.CircuitBreaker != nil {
+		if err := groupOption.CircuitBreaker.validate(); err != nil {
+			return err
+		}
+	}
+
+	if groupOption.RetryPolicy != nil {
+		if _, err := newRetryPolicy(groupOption.RetryPolicy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate 校验配置
+func (poolOption *PoolOption) Validate() error {
+	if strings.TrimSpace(poolOption.Dsn) == "" {
+		return ErrEmptyDsn
+	}
+
+	if poolOption.MaxConnLifetime < 0 || poolOption.MaxOpenConns < 0 || poolOption.MaxIdleConns < 0 || poolOption.Weight < 0 {
+		return ErrInvalidOption
+	}
+
+	return nil
+}
+
+// Manager 按名称管理多个Group，Group在第一次Get时创建
+type Manager struct {
+	mutex   sync.Mutex
+	options map[string]*GroupOption
+	groups  map[string]Group
+	closed  bool
+}
+
+// NewManager 创建Manager，创建前校验所有配置
+func NewManager(options map[string]*GroupOption) (*Manager, error) {
+	for name, option := range options {
+		if option == nil {
+			return nil, fmt.Errorf("group %s: %w", name, ErrNoMasters)
+		}
+
+		if err := option.Validate(); err != nil {
+			return nil, fmt.Errorf("group %s: %w", name, err)
+		}
+	}
+
+	return &Manager{
+		options: options,
+		groups:  make(map[string]Group, len(options)),
+	}, nil
+}
+
+// NewManagerFromFile 从yaml或json文件加载配置创建Manager，格式由扩展名(.yml、.yaml、.json)决定
+func NewManagerFromFile(filePath string) (*Manager, error) {
+	var (
+		options = map[string]*GroupOption{}
+		err     error
+	)
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".yml", ".yaml":
+		err = base.YamlDecodeFile(filePath, &options)
+	case ".json":
+		err = base.JsonDecodeFile(filePath, &options)
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewManager(options)
+}
+
+// NewManagerFromReader 从reader加载format格式的配置创建Manager
+func NewManagerFromReader(reader io.Reader, format string) (*Manager, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	options := map[string]*GroupOption{}
+
+	switch format {
+	case FormatYaml:
+		err = base.YamlDecode(data, &options)
+	case FormatJson:
+		err = base.JsonDecode(data, &options)
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewManager(options)
+}
+
+// Names 所有Group名称
+func (m *Manager) Names() []string {
+	names := make([]string, 0, len(m.options))
+	for name := range m.options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get 获取名为name的Group，第一次获取时创建
+func (m *Manager) Get(name string) (Group, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil, ErrManagerClosed
+	}
+
+	if group, exists := m.groups[name]; exists {
+		return group, nil
+	}
+
+	option, exists := m.options[name]
+	if !exists {
+		return nil, ErrGroupNotFound
+	}
+
+	group, err := NewMysqlGroup(option)
+	if err != nil {
+		return nil, fmt.Errorf("group %s: %w", name, err)
+	}
+
+	m.groups[name] = group
+	return group, nil
+}
+
+// Close 关闭所有已创建的Group，关闭后Get返回ErrManagerClosed
+func (m *Manager) Close() (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	for _, group := range m.groups {
+		if closeErr := group.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	m.groups = nil
+	return err
+}
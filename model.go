@@ -0,0 +1,133 @@
+package orm
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	modelMetas sync.Map
+)
+
+// fieldMeta borm字段元数据
+type fieldMeta struct {
+	index    int
+	column   string
+	primary  bool
+	required bool
+}
+
+// modelMeta 结构体元数据，每个reflect.Type只解析一次
+type modelMeta struct {
+	table   string
+	fields  []fieldMeta
+	columns map[string]int
+	primary []int
+
+	beforeSave   int
+	beforeCreate int
+	beforeUpdate int
+}
+
+// getModelMeta 获取结构体元数据，t必须为struct类型
+func getModelMeta(t reflect.Type) *modelMeta {
+	if meta, ok := modelMetas.Load(t); ok {
+		return meta.(*modelMeta)
+	}
+
+	meta, _ := modelMetas.LoadOrStore(t, newModelMeta(t))
+	return meta.(*modelMeta)
+}
+
+func newModelMeta(t reflect.Type) *modelMeta {
+	var (
+		fieldCount = t.NumField()
+		ptrType    = reflect.PtrTo(t)
+
+		meta = &modelMeta{
+			table:        tableName(reflect.New(t).Elem()),
+			fields:       make([]fieldMeta, 0, fieldCount),
+			columns:      make(map[string]int, fieldCount),
+			beforeSave:   hookIndex(ptrType, beforeSave),
+			beforeCreate: hookIndex(ptrType, beforeCreate),
+			beforeUpdate: hookIndex(ptrType, beforeUpdate),
+		}
+	)
+
+	for i := 0; i < fieldCount; i++ {
+		tag := t.Field(i).Tag.Get(tagName)
+		if tag == "" {
+			continue
+		}
+
+		tags := strings.Split(tag, ",")
+		field := fieldMeta{
+			index:  i,
+			column: tags[0],
+		}
+
+		for _, val := range tags[1:] {
+			switch strings.TrimSpace(val) {
+			case required:
+				field.required = true
+			case primary:
+				field.primary = true
+			}
+		}
+
+		if field.primary {
+			meta.primary = append(meta.primary, len(meta.fields))
+		}
+
+		meta.columns[field.column] = len(meta.fields)
+		meta.fields = append(meta.fields, field)
+	}
+
+	return meta
+}
+
+func hookIndex(ptrType reflect.Type, name string) int {
+	method, ok := ptrType.MethodByName(name)
+	if !ok || method.Type.NumIn() != 1 {
+		return -1
+	}
+	return method.Index
+}
+
+// callHook 调用钩子方法，ptr为指向结构体的指针
+func callHook(ptr reflect.Value, index int) {
+	if index < 0 {
+		return
+	}
+	ptr.Method(index).Call(nil)
+}
+
+// primaryFields 主键条件，value为结构体
+func (mm *modelMeta) primaryFields(value reflect.Value) OrderedFieldMap {
+	fields := make(OrderedFieldMap, 0, len(mm.primary))
+	for _, position := range mm.primary {
+		field := mm.fields[position]
+		fields = append(fields, FieldItem{
+			Field: "`" + field.column + "`",
+			Value: []interface{}{value.Field(field.index).Interface()},
+		})
+	}
+	return fields
+}
+
+// scanDests 生成一行的扫描目标，value为结构体，未映射的列丢弃
+func (mm *modelMeta) scanDests(value reflect.Value, columns []string, dests []interface{}) []interface{} {
+	for index, column := range columns {
+		position, exists := mm.columns[column]
+		if !exists {
+			dests[index] = &sql.RawBytes{}
+			continue
+		}
+
+		dests[index] = scanDest(value.Field(mm.fields[position].index))
+	}
+
+	return dests
+}
@@ -16,11 +16,21 @@ CREATE TABLE `user` (
 // brew services start mysql
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
+	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/grpc-boot/base"
 )
 
@@ -155,6 +165,47 @@ func TestWhere_Sql(t *testing.T) {
 	t.Log(w.Sql(&args), args)
 }
 
+func TestNestedCondition_Sql(t *testing.T) {
+	// (a=1 OR b=2) AND (c=3 OR (d=4 AND e=5))
+	con := All(
+		Any(
+			AndCondition(FieldMap{"a": {1}}),
+			AndCondition(FieldMap{"b": {2}}),
+		),
+		Any(
+			AndCondition(FieldMap{"c": {3}}),
+			All(
+				AndCondition(FieldMap{"d": {4}}),
+				AndCondition(FieldMap{"e": {5}}),
+			),
+		),
+		Not(AndCondition(FieldMap{"f": {`IN`, 6, 7}})),
+		All(),
+	)
+
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sql := NewWhere(con).Sql(&args)
+	if sql != " WHERE (((a = ?) OR (b = ?)) AND ((c = ?) OR ((d = ?) AND (e = ?))) AND (NOT (f IN(?,?))))" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	for index, arg := range args {
+		if arg != index+1 {
+			t.Fatalf("unexpected args: %v", args)
+		}
+	}
+
+	args = args[:0]
+	sql = NewWhere(All()).And(Any(AndCondition(FieldMap{"a": {1}}))).Sql(&args)
+	if sql != " WHERE ((a = ?))" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	t.Log(sql, args)
+}
+
 func TestMysqlQuery_Sql(t *testing.T) {
 	query := AcquireQuery4Mysql()
 	defer query.Close()
@@ -184,6 +235,36 @@ func TestMysqlQuery_Sql(t *testing.T) {
 	t.Log(query.Sql(&args), args)
 }
 
+func TestMysqlQuery_Join(t *testing.T) {
+	query := AcquireQuery4Mysql()
+	defer query.Close()
+
+	query.Select("`u`.`id`", "`u`.`nickname`", "`o`.`amount`").
+		From("`user` AS `u`").
+		Join("`order`", "`o`", On("`o`.`user_id`", "`u`.`id`"), AndCondition(FieldMap{
+			"`o`.`status`": {1},
+		})).
+		LeftJoin("`profile`", "`p`", On("`p`.`user_id`", "`u`.`id`")).
+		Where(AndWhere(FieldMap{
+			"`u`.`is_on`": {1},
+		})).
+		Limit(10)
+
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sql := query.Sql(&args)
+	if sql != "SELECT `u`.`id`,`u`.`nickname`,`o`.`amount` FROM `user` AS `u` INNER JOIN `order` AS `o` ON (`o`.`user_id` = `u`.`id`) AND (`o`.`status` = ?) LEFT JOIN `profile` AS `p` ON (`p`.`user_id` = `u`.`id`) WHERE (`u`.`is_on` = ?) LIMIT 0,10" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	if len(args) != 2 || args[0] != 1 || args[1] != 1 {
+		t.Fatalf("unexpected args: %v", args)
+	}
+
+	t.Log(sql, args)
+}
+
 func TestInsert(t *testing.T) {
 	args := base.AcquireArgs()
 	defer base.ReleaseArgs(&args)
@@ -198,6 +279,164 @@ func TestInsert(t *testing.T) {
 	t.Log(sql, args)
 }
 
+func TestDeterministicSql(t *testing.T) {
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	for i := 0; i < 10; i++ {
+		args = args[:0]
+		sql := SqlInsert(&args, "`user`", Row{
+			"`nickname`":   "a",
+			"`created_at`": 1,
+			"`is_on`":      1,
+		}, Row{
+			"`is_on`":      0,
+			"`nickname`":   "b",
+			"`created_at`": 2,
+		})
+		if sql != "INSERT INTO `user`(`created_at`,`is_on`,`nickname`)VALUES(?,?,?),(?,?,?)" {
+			t.Fatalf("unexpected sql: %s", sql)
+		}
+
+		args = args[:0]
+		sql = SqlUpdate(&args, "`user`", Row{
+			"`nickname`":   "a",
+			"`updated_at`": 1,
+		}, AndWhere(FieldMap{
+			"`is_on`": {1},
+			"`id`":    {`>`, 10},
+		}))
+		if sql != "UPDATE `user` SET `nickname`=?,`updated_at`=? WHERE (`id` > ? AND `is_on` = ?)" {
+			t.Fatalf("unexpected sql: %s", sql)
+		}
+	}
+
+	args = args[:0]
+	sql := SqlInsertOrdered(&args, "`user`", OrderedRow{
+		{Field: "`nickname`", Value: "a"},
+		{Field: "`created_at`", Value: 1},
+	})
+	if sql != "INSERT INTO `user`(`nickname`,`created_at`)VALUES(?,?)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	args = args[:0]
+	sql = SqlInsertOrdered(&args, "`user`", OrderedRow{
+		{Field: "`nickname`", Value: "a"},
+		{Field: "`created_at`", Value: 1},
+	}, OrderedRow{
+		{Field: "`created_at`", Value: 2},
+		{Field: "`nickname`", Value: "b"},
+	}, OrderedRow{
+		{Field: "`nickname`", Value: "c"},
+	})
+	if sql != "INSERT INTO `user`(`nickname`,`created_at`)VALUES(?,?),(?,?),(?,?)" || !reflect.DeepEqual(args, []interface{}{"a", 1, "b", 2, "c", nil}) {
+		t.Fatalf("unexpected sql: %s %v", sql, args)
+	}
+
+	args = args[:0]
+	sql = SqlUpdateOrdered(&args, "`user`", OrderedRow{
+		{Field: "`updated_at`", Value: 1},
+		{Field: "`nickname`", Value: "a"},
+	}, NewWhere(AndOrderedCondition(OrderedFieldMap{
+		{Field: "`is_on`", Value: []interface{}{1}},
+		{Field: "`id`", Value: []interface{}{`>`, 10}},
+	})))
+	if sql != "UPDATE `user` SET `updated_at`=?,`nickname`=? WHERE (`is_on` = ? AND `id` > ?)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	t.Log(sql, args)
+}
+
+func TestExpr(t *testing.T) {
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sql := SqlUpdate(&args, "`user`", Row{
+		"`login_times`": Expr("`login_times`+?", 1),
+		"`updated_at`":  Expr("NOW()"),
+		"`nickname`":    "a",
+	}, NewWhere(AndCondition(FieldMap{
+		"`updated_at`": {`<`, Expr("`created_at`")},
+		"`id`":         {`IN`, 1, Expr("?+1", 1)},
+	})))
+	if sql != "UPDATE `user` SET `login_times`=`login_times`+?,`nickname`=?,`updated_at`=NOW() WHERE (`id` IN(?,?+1) AND `updated_at` < `created_at`)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	if len(args) != 4 || args[0] != 1 || args[1] != "a" {
+		t.Fatalf("unexpected args: %v", args)
+	}
+
+	args = args[:0]
+	sql = SqlInsert(&args, "`user`", Row{"`nickname`": "a", "`created_at`": Expr("UNIX_TIMESTAMP()")}, Row{"`nickname`": "b", "`created_at`": 1})
+	if sql != "INSERT INTO `user`(`created_at`,`nickname`)VALUES(UNIX_TIMESTAMP(),?),(?,?)" || len(args) != 3 {
+		t.Fatalf("unexpected sql: %s %v", sql, args)
+	}
+
+	query := AcquireQuery4Mysql()
+	defer query.Close()
+
+	args = args[:0]
+	columns := []string{"`id`"}
+	sql = query.Select(columns...).SelectExpr(Expr("IF(`is_on`=?, 'on', 'off') AS `state`", 1)).From("`user`").Where(AndWhere(FieldMap{"`id`": {2}})).Sql(&args)
+	if sql != "SELECT `id`,IF(`is_on`=?, 'on', 'off') AS `state` FROM `user` WHERE (`id` = ?)" || len(args) != 2 || args[0] != 1 {
+		t.Fatalf("unexpected sql: %s %v", sql, args)
+	}
+
+	t.Log(sql, args)
+}
+
+func TestUpsert(t *testing.T) {
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	row := Row{
+		"`nickname`":   "a",
+		"`created_at`": 1,
+	}
+
+	sql := SqlUpsert(&args, "`user`", nil, row)
+	if sql != "INSERT INTO `user`(`created_at`,`nickname`)VALUES(?,?) ON DUPLICATE KEY UPDATE `created_at`=VALUES(`created_at`),`nickname`=VALUES(`nickname`)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	args = args[:0]
+	sql = SqlUpsert(&args, "`user`", OnDuplicateKeyUpdate().Values("`nickname`").Set("`is_on`", 1).Expr("`login_times`", "`login_times`+?", 1), row)
+	if sql != "INSERT INTO `user`(`created_at`,`nickname`)VALUES(?,?) ON DUPLICATE KEY UPDATE `nickname`=VALUES(`nickname`),`is_on`=?,`login_times`=`login_times`+?" || len(args) != 4 {
+		t.Fatalf("unexpected sql: %s %v", sql, args)
+	}
+
+	args = args[:0]
+	sql = SqlUpsert(&args, "`user`", InsertIgnore(), row)
+	if sql != "INSERT IGNORE INTO `user`(`created_at`,`nickname`)VALUES(?,?)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	args = args[:0]
+	sql, err := SqlUpsertObjs(&args, nil, &User{Id: 1, NickName: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sql != "INSERT INTO `user`(`id`,`nickname`,`is_on`,`created_at`,`updated_at`)VALUES(?,?,?,?,?) ON DUPLICATE KEY UPDATE `nickname`=VALUES(`nickname`),`is_on`=VALUES(`is_on`),`created_at`=VALUES(`created_at`),`updated_at`=VALUES(`updated_at`)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	args = args[:0]
+	sql, err = SqlUpsertObjs(&args, ReplaceInto(), []*User{{NickName: "a"}, {NickName: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sql != "REPLACE INTO `user`(`nickname`,`is_on`,`created_at`,`updated_at`)VALUES(?,?,?,?),(?,?,?,?)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	t.Log(sql, args)
+}
+
 func TestUpdateAll(t *testing.T) {
 	args := base.AcquireArgs()
 	defer base.ReleaseArgs(&args)
@@ -248,6 +487,180 @@ func TestInsertObjs(t *testing.T) {
 	t.Log(sql, args)
 }
 
+func TestModelMeta(t *testing.T) {
+	meta := getModelMeta(reflect.TypeOf(User{}))
+	if meta != getModelMeta(reflect.TypeOf(User{})) {
+		t.Fatal("model meta should be cached per type")
+	}
+
+	if meta.table != "user" || len(meta.fields) != 5 || len(meta.primary) != 1 {
+		t.Fatalf("unexpected meta: %+v", meta)
+	}
+
+	if !meta.fields[meta.columns["is_on"]].required || !meta.fields[meta.primary[0]].primary {
+		t.Fatalf("unexpected field flags: %+v", meta.fields)
+	}
+
+	if meta.beforeSave < 0 || meta.beforeCreate < 0 || meta.beforeUpdate >= 0 {
+		t.Fatalf("unexpected hooks: %+v", meta)
+	}
+}
+
+func TestScanDest(t *testing.T) {
+	type Profile struct {
+		Id       int64          `borm:"id,primary"`
+		Avatar   []byte         `borm:"avatar"`
+		Nickname *string        `borm:"nickname"`
+		Remark   sql.NullString `borm:"remark"`
+		Score    *float64       `borm:"score"`
+		IsOn     bool           `borm:"is_on"`
+		Birthday time.Time      `borm:"birthday"`
+		LoginAt  *time.Time     `borm:"login_at"`
+	}
+
+	var (
+		p       Profile
+		meta    = getModelMeta(reflect.TypeOf(p))
+		columns = []string{"id", "avatar", "nickname", "remark", "score", "is_on", "birthday", "login_at", "unknown"}
+		src     = []interface{}{[]byte("12"), []byte{0x1, 0x2}, []byte("nick"), nil, nil, int64(1), []byte("2022-01-09 17:05:14"), time.Unix(1641719114, 0), []byte("x")}
+		dests   = meta.scanDests(reflect.ValueOf(&p).Elem(), columns, make([]interface{}, len(columns)))
+	)
+
+	for index, dest := range dests {
+		scanner, ok := dest.(sql.Scanner)
+		if !ok {
+			continue
+		}
+
+		if err := scanner.Scan(src[index]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if p.Id != 12 || len(p.Avatar) != 2 || p.Nickname == nil || *p.Nickname != "nick" || p.Remark.Valid || p.Score != nil || !p.IsOn {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+
+	if p.Birthday.Format("2006-01-02 15:04:05") != "2022-01-09 17:05:14" || p.LoginAt == nil || p.LoginAt.Unix() != 1641719114 {
+		t.Fatalf("unexpected time fields: %+v", p)
+	}
+
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sql, err := SqlUpdateByObj(&args, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sql != "UPDATE `profile` SET `avatar`=?,`nickname`=?,`is_on`=?,`birthday`=?,`login_at`=? WHERE (`id` = ?)" {
+		t.Fatalf("unexpected sql: %s", sql)
+	}
+
+	t.Log(sql, args)
+}
+
+type insertResult int64
+
+func (ir insertResult) LastInsertId() (int64, error) {
+	return int64(ir), nil
+}
+
+func (ir insertResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+// rowsDriver 返回固定行数的测试驱动
+type rowsDriver struct{}
+
+func (rowsDriver) Open(name string) (driver.Conn, error) {
+	return rowsConn{}, nil
+}
+
+type rowsConn struct{}
+
+func (rowsConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (rowsConn) Close() error {
+	return nil
+}
+
+func (rowsConn) Begin() (driver.Tx, error) {
+	return nil, driver.ErrSkip
+}
+
+func (rowsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fixedRows{count: 2}, nil
+}
+
+type fixedRows struct {
+	count int
+}
+
+func (fr *fixedRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (fr *fixedRows) Close() error {
+	return nil
+}
+
+func (fr *fixedRows) Next(dest []driver.Value) error {
+	if fr.count < 1 {
+		return io.EOF
+	}
+	fr.count--
+	dest[0] = int64(fr.count)
+	return nil
+}
+
+func TestToObjListClose(t *testing.T) {
+	sql.Register("orm_rows", rowsDriver{})
+	db, err := sql.Open("orm_rows", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT `id`")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := ToObjList(rows, &struct{ Name string }{})
+	if err != nil || list != nil {
+		t.Fatalf("unexpected list: %v %v", list, err)
+	}
+
+	if inUse := db.Stats().InUse; inUse != 0 {
+		t.Fatalf("rows should be closed: %d", inUse)
+	}
+}
+
+func TestFillInsertId(t *testing.T) {
+	users := []*User{{NickName: "a"}, {NickName: "b"}, {NickName: "c"}}
+	if err := fillInsertId(users, insertResult(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	for index, user := range users {
+		if user.Id != int64(100+index) {
+			t.Fatalf("unexpected id: %d", user.Id)
+		}
+	}
+
+	user := &User{Id: 7}
+	if err := fillInsertId(user, insertResult(100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Id != 7 {
+		t.Fatalf("explicit id should not be overwritten: %d", user.Id)
+	}
+}
+
 func TestUpdateByObj(t *testing.T) {
 	args := base.AcquireArgs()
 	defer base.ReleaseArgs(&args)
@@ -278,6 +691,1003 @@ func TestDeleteByObj(t *testing.T) {
 	t.Log(sql, args)
 }
 
+func TestFindByPk(t *testing.T) {
+	var (
+		_ Querier = g
+		_ Querier = (*transaction)(nil)
+	)
+
+	column, err := primaryColumn(reflect.TypeOf(User{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if column != "id" {
+		t.Fatalf("unexpected primary column: %s", column)
+	}
+
+	_, err = FindByPk[struct{ Name string }](context.Background(), g, 1)
+	if err != ErrNotFoundPrimaryField {
+		t.Fatalf("expected ErrNotFoundPrimaryField, got %v", err)
+	}
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	if !isRetryableTxError(fmt.Errorf("commit: %w", &mysql.MySQLError{Number: 1213})) {
+		t.Fatal("deadlock should be retryable")
+	}
+
+	if !isRetryableTxError(&mysql.MySQLError{Number: 1205}) {
+		t.Fatal("lock wait timeout should be retryable")
+	}
+
+	if isRetryableTxError(&mysql.MySQLError{Number: 1062}) || isRetryableTxError(ErrNoMasterConn) {
+		t.Fatal("only deadlock and lock wait timeout should be retryable")
+	}
+}
+
+func TestWrapError(t *testing.T) {
+	err := wrapError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"})
+	if !errors.Is(err, ErrDuplicateKey) || errors.Is(err, ErrDeadlock) {
+		t.Fatalf("unexpected kind: %v", err)
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != 1062 {
+		t.Fatal("original error should be unwrapped")
+	}
+
+	if !errors.Is(wrapError(sql.ErrNoRows), ErrNotFound) || !errors.Is(wrapError(sql.ErrNoRows), sql.ErrNoRows) {
+		t.Fatal("no rows should be not found")
+	}
+
+	if !errors.Is(wrapError(driver.ErrBadConn), ErrConnection) {
+		t.Fatal("bad conn should be connection error")
+	}
+
+	if !errors.Is(wrapError(&mysql.MySQLError{Number: 1290}), ErrReadOnly) {
+		t.Fatal("1290 should be read-only")
+	}
+
+	if wrapError(context.Canceled) != context.Canceled || wrapError(nil) != nil {
+		t.Fatal("unclassified error should not be wrapped")
+	}
+}
+
+func TestReadOnlyMasterDown(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		Slaves:  []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	gp := mg.(*group)
+	readOnly := &mysql.MySQLError{Number: 1290}
+
+	if gp.isBadConnError(0, 0, readOnly, false) {
+		t.Fatal("read-only slave should stay up")
+	}
+
+	if !gp.isBadConnError(0, 0, readOnly, true) || len(mg.BadPool(true)) != 1 {
+		t.Fatal("read-only master should be marked down")
+	}
+}
+
+func TestWithTransaction(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := TransactionFrom(ctx); ok {
+		t.Fatal("empty context should not carry a transaction")
+	}
+
+	tx := newTx(context.Background(), nil)
+	got, ok := TransactionFrom(WithTransaction(ctx, tx))
+	if !ok || got != tx {
+		t.Fatal("transaction should be carried by context")
+	}
+
+	if _, ok = TransactionFrom(WithTransaction(ctx, nil)); ok {
+		t.Fatal("nil transaction should be ignored")
+	}
+}
+
+func TestGroup_Stats(t *testing.T) {
+	list := g.Stats()
+	if len(list) != 9 {
+		t.Fatalf("unexpected stats length: %d", len(list))
+	}
+
+	if list[0].Role != RoleMaster || list[4].Role != RoleSlave || list[4].Index != 0 {
+		t.Fatalf("unexpected stats: %+v", list)
+	}
+
+	t.Log(list)
+}
+
+type firstBalancer struct{}
+
+func (fb firstBalancer) Select(nodes []Node) int {
+	return 0
+}
+
+func TestBalancer(t *testing.T) {
+	nodes := []Node{{Index: 0, Weight: 1}, {Index: 1, Weight: 0}, {Index: 2, Weight: 3}}
+
+	rr, err := newBalancer("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 6; i++ {
+		if index := rr.Select(nodes); index != i%3 {
+			t.Fatalf("round robin selected %d at %d", index, i)
+		}
+	}
+
+	w, _ := newBalancer(BalancerWeighted)
+	for i := 0; i < 100; i++ {
+		if w.Select(nodes) == 1 {
+			t.Fatal("weighted balancer selected a zero weight node")
+		}
+	}
+
+	if _, err = newBalancer("unknown"); err == nil {
+		t.Fatal("unknown balancer should fail")
+	}
+
+	RegisterBalancer("first", func() Balancer { return firstBalancer{} })
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters:  []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}, {Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		Balancer: "first",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	if index, _, _, _ := mg.(*group).getSlave(0); index != 0 {
+		t.Fatalf("custom balancer selected %d", index)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters:             []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:1)/dd?timeout=1s`}},
+		HealthCheckInterval: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan StateEvent, 4)
+	mg.OnStateChange(func(event StateEvent) {
+		events <- event
+	})
+
+	select {
+	case event := <-events:
+		if event.Up || event.Index != 0 {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("health check should mark the pool down")
+	}
+
+	if len(mg.BadPool(true)) != 1 {
+		t.Fatalf("unexpected bad pool: %v", mg.BadPool(true))
+	}
+
+	_ = mg.Close()
+}
+
+func TestReplicationLag(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		Slaves:  []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}, {Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		ReplicationLag: &LagOption{
+			MaxLag: 1000,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	gp := mg.(*group)
+	gp.slaveLag[0].Store(5000)
+
+	for i := 0; i < 4; i++ {
+		index, _, _, ok := gp.getSlave(gp.maxLag(context.Background()))
+		if !ok || index != 1 {
+			t.Fatalf("lagging slave selected: %d %v", index, ok)
+		}
+	}
+
+	gp.slaveLag[1].Store(math.MaxInt64)
+	if _, _, _, ok := gp.getSlave(gp.maxLag(context.Background())); ok {
+		t.Fatal("should fall back to master")
+	}
+
+	ctx := WithMaxLag(context.Background(), 10*time.Second)
+	if index, _, _, ok := gp.getSlave(gp.maxLag(ctx)); !ok || index != 0 {
+		t.Fatalf("unexpected slave: %d %v", index, ok)
+	}
+
+	if stats := mg.Stats(); stats[len(stats)-1].Lag != math.MaxInt64 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	intercepted := 0
+	mg.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		intercepted++
+		return invoker(ctx, stmt)
+	})
+
+	probe := newLagProbe(gp.slaves[0], &LagOption{})
+	if _, ok := probe.pool.(*groupPool); ok {
+		t.Fatal("probe should use the underlying pool")
+	}
+
+	_, _ = probe.lag(context.Background())
+	if intercepted != 0 {
+		t.Fatalf("probe went through interceptors: %d", intercepted)
+	}
+
+	for _, table := range []string{"hb`; DROP TABLE `user", "a.b.c", "hb "} {
+		if _, err = NewMysqlGroup(&GroupOption{
+			Masters:        []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+			ReplicationLag: &LagOption{HeartbeatTable: table},
+		}); err != ErrInvalidHeartbeat {
+			t.Fatalf("invalid heartbeat table accepted: %s %v", table, err)
+		}
+	}
+
+	probe = newLagProbe(gp.slaves[0], &LagOption{HeartbeatTable: "percona.heartbeat"})
+	if probe.heartbeatSql != "SELECT TIMESTAMPDIFF(MICROSECOND, MAX(`ts`), NOW(6)) FROM `percona`.`heartbeat`" {
+		t.Fatalf("unexpected heartbeat sql: %s", probe.heartbeatSql)
+	}
+
+	//首次检测成功前从库延迟未知，不参与选择
+	monitored, err := NewMysqlGroup(&GroupOption{
+		Masters:        []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:1)/dd?timeout=1s`}},
+		Slaves:         []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:1)/dd?timeout=1s`}},
+		ReplicationLag: &LagOption{Interval: 60, MaxLag: 1000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitored.Close()
+
+	mgp := monitored.(*group)
+	if _, _, _, ok := mgp.getSlave(mgp.maxLag(context.Background())); ok {
+		t.Fatal("slave with unknown lag should not be selected")
+	}
+}
+
+func TestSession(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters:      []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		StickyMaster: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	var (
+		gp    = mg.(*group)
+		ctx   = WithSession(context.Background())
+		keyed = WithSessionKey(context.Background(), "user:1")
+	)
+
+	if gp.sticky(ctx) || gp.sticky(keyed) {
+		t.Fatal("session should not be sticky before write")
+	}
+
+	gp.stick(ctx)
+	gp.stick(keyed)
+
+	if !gp.sticky(ctx) || !gp.sticky(WithSessionKey(context.Background(), "user:1")) {
+		t.Fatal("session should be sticky after write")
+	}
+
+	if gp.sticky(WithSession(context.Background())) || gp.sticky(WithSessionKey(context.Background(), "user:2")) {
+		t.Fatal("other session should not be sticky")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if gp.sticky(ctx) || gp.sticky(keyed) {
+		t.Fatal("session should expire")
+	}
+}
+
+type logEntry struct {
+	level  Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type memLogger struct {
+	min     Level
+	entries []logEntry
+}
+
+func (ml *memLogger) Enabled(level Level) bool {
+	return level >= ml.min
+}
+
+func (ml *memLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	entry := logEntry{level: level, msg: msg, fields: map[string]interface{}{}}
+	for _, field := range fields {
+		entry.fields[field.Key] = field.Value
+	}
+	ml.entries = append(ml.entries, entry)
+}
+
+func TestLogger(t *testing.T) {
+	logger := &memLogger{}
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters:       []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		Logger:        logger,
+		SlowThreshold: 100,
+		RedactArgs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	gp := mg.(*group)
+	ctx := context.Background()
+
+	gp.logStatement(ctx, RoleMaster, 0, "UPDATE `user` SET `is_on`=?", []interface{}{1}, time.Now(), insertResult(0), nil)
+	gp.logStatement(ctx, RoleSlave, 1, "SELECT 1", nil, time.Now().Add(-time.Second), nil, nil)
+	gp.logStatement(ctx, RoleMaster, 0, "INSERT", nil, time.Now(), nil, &mysql.MySQLError{Number: 1062})
+
+	if len(logger.entries) != 3 {
+		t.Fatalf("unexpected entries: %+v", logger.entries)
+	}
+
+	first := logger.entries[0]
+	if first.level != LevelDebug || first.fields["rows"] != int64(1) || first.fields["args"] != "[1 redacted]" || first.fields["role"] != RoleMaster {
+		t.Fatalf("unexpected entry: %+v", first)
+	}
+
+	if logger.entries[1].level != LevelWarn || logger.entries[1].msg != "slow sql" || logger.entries[1].fields["index"] != 1 {
+		t.Fatalf("unexpected entry: %+v", logger.entries[1])
+	}
+
+	if logger.entries[2].level != LevelWarn || logger.entries[2].fields["error"] == nil {
+		t.Fatalf("unexpected entry: %+v", logger.entries[2])
+	}
+
+	logger.entries, logger.min = nil, LevelWarn
+	gp.logStatement(ctx, RoleMaster, 0, "UPDATE `user` SET `is_on`=?", []interface{}{1}, time.Now(), insertResult(0), nil)
+	gp.logStatement(ctx, RoleSlave, 1, "SELECT 1", nil, time.Now().Add(-time.Second), nil, nil)
+
+	if len(logger.entries) != 1 || logger.entries[0].msg != "slow sql" {
+		t.Fatalf("unexpected entries: %+v", logger.entries)
+	}
+
+	if std := NewStdLogger(LevelError).(LevelEnabler); std.Enabled(LevelWarn) || !std.Enabled(LevelError) {
+		t.Fatal("unexpected std logger level")
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	var (
+		order    []string
+		executed *Statement
+		injected = errors.New("injected")
+	)
+
+	mg.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		order = append(order, "outer")
+		stmt.Sql = "/* audit */ " + stmt.Sql
+		return invoker(ctx, stmt)
+	}, func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		order = append(order, "inner")
+		executed = stmt
+		if stmt.Op == OpQuery {
+			return nil, injected
+		}
+		return &Reply{Result: insertResult(7)}, nil
+	})
+
+	result, err := mg.Exec("UPDATE `user` SET `is_on`=?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, _ := result.LastInsertId(); id != 7 {
+		t.Fatalf("unexpected result: %v", id)
+	}
+
+	if executed.Op != OpExec || executed.Role != RoleMaster || executed.Sql != "/* audit */ UPDATE `user` SET `is_on`=?" || len(executed.Args) != 1 {
+		t.Fatalf("unexpected statement: %+v", executed)
+	}
+
+	if _, err = mg.Query(true, "SELECT 1"); !errors.Is(err, injected) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(order) != 4 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("unexpected order: %v", order)
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	var (
+		executed []string
+		failed   = errors.New("failed")
+	)
+
+	mg.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		executed = append(executed, stmt.Sql)
+		return &Reply{Result: insertResult(0)}, nil
+	})
+
+	tx := &transaction{group: mg.(*group), role: RoleMaster}
+
+	err = tx.Transaction(func(tx Transaction) error {
+		if err := tx.Transaction(func(tx Transaction) error {
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if err := tx.Transaction(func(tx Transaction) error {
+			return failed
+		}); !errors.Is(err, failed) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"SAVEPOINT `orm_sp_1`",
+		"SAVEPOINT `orm_sp_2`",
+		"RELEASE SAVEPOINT `orm_sp_2`",
+		"SAVEPOINT `orm_sp_3`",
+		"ROLLBACK TO SAVEPOINT `orm_sp_3`",
+		"RELEASE SAVEPOINT `orm_sp_1`",
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("unexpected statements: %v", executed)
+	}
+
+	executed = executed[:0]
+	func() {
+		defer func() {
+			if r := recover(); r != failed {
+				t.Fatalf("unexpected recover: %v", r)
+			}
+		}()
+
+		_ = tx.Transaction(func(tx Transaction) error {
+			panic(failed)
+		})
+	}()
+
+	expected = []string{
+		"SAVEPOINT `orm_sp_4`",
+		"ROLLBACK TO SAVEPOINT `orm_sp_4`",
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("unexpected statements: %v", executed)
+	}
+
+	executed = executed[:0]
+	err = mg.TransactionContext(WithTransaction(context.Background(), tx), nil, func(ctx context.Context, nested Transaction) error {
+		if bound, ok := TransactionFrom(ctx); !ok || bound != tx || nested != tx {
+			t.Fatalf("unexpected transaction: %v", bound)
+		}
+		_, err := mg.ExecContext(ctx, "UPDATE `user` SET `is_on`=?", 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []string{
+		"SAVEPOINT `orm_sp_5`",
+		"UPDATE `user` SET `is_on`=?",
+		"RELEASE SAVEPOINT `orm_sp_5`",
+	}
+	if !reflect.DeepEqual(executed, expected) {
+		t.Fatalf("unexpected statements: %v", executed)
+	}
+
+	executed = executed[:0]
+	for _, name := range []string{"", "sp`; DROP TABLE `user", "sp 1", "sp-1"} {
+		if tx.Savepoint(name) != ErrInvalidSavepoint || tx.RollbackTo(name) != ErrInvalidSavepoint || tx.Release(name) != ErrInvalidSavepoint {
+			t.Fatalf("invalid savepoint name accepted: %s", name)
+		}
+	}
+
+	if err = tx.Savepoint("Sp_1"); err != nil || len(executed) != 1 || executed[0] != "SAVEPOINT `Sp_1`" {
+		t.Fatalf("unexpected statements: %v %v", executed, err)
+	}
+
+	executed = executed[:0]
+	err = mg.Transaction(WithTransaction(context.Background(), tx), nil, func(nested Transaction) error {
+		_, err := nested.Exec("UPDATE `user` SET `is_on`=?", 0)
+		return err
+	})
+	if err != nil || len(executed) != 3 || executed[0] != "SAVEPOINT `orm_sp_6`" {
+		t.Fatalf("unexpected statements: %v %v", executed, err)
+	}
+}
+
+func TestTransactionBaseContext(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	type traceKey struct{}
+
+	var traces []interface{}
+	mg.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		traces = append(traces, ctx.Value(traceKey{}))
+		return &Reply{Result: insertResult(0)}, nil
+	})
+
+	tx := &transaction{group: mg.(*group), role: RoleMaster, ctx: context.WithValue(context.Background(), traceKey{}, "begin")}
+	_, _ = tx.Exec("UPDATE `user` SET `is_on`=?", 1)
+	_, _ = tx.UpdateAll("`user`", Row{"`is_on`": 1}, nil)
+	_ = tx.Savepoint("sp")
+	_ = tx.ReleaseContext(context.WithValue(context.Background(), traceKey{}, "release"), "sp")
+
+	if !reflect.DeepEqual(traces, []interface{}{"begin", "begin", "begin", "release"}) {
+		t.Fatalf("unexpected contexts: %v", traces)
+	}
+}
+
+func TestForeignTransaction(t *testing.T) {
+	var groups [2]Group
+	for index := range groups {
+		mg, err := NewMysqlGroup(&GroupOption{
+			Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mg.Close()
+		groups[index] = mg
+	}
+
+	var (
+		ga, gb   = groups[0], groups[1]
+		txA      = &transaction{group: ga.(*group), role: RoleMaster}
+		txB      = &transaction{group: gb.(*group), role: RoleMaster}
+		executed []*Statement
+	)
+
+	for _, mg := range groups {
+		mg.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+			executed = append(executed, stmt)
+			if stmt.Op == OpBegin {
+				return &Reply{Tx: txB}, nil
+			}
+			return &Reply{Result: insertResult(0)}, nil
+		})
+	}
+
+	ctx := WithTransaction(context.Background(), txA)
+	if _, err := ga.ExecContext(ctx, "UPDATE `user` SET `is_on`=?", 1); err != nil || executed[0].Tx != txA {
+		t.Fatalf("statement should run on the bound transaction: %+v %v", executed[0], err)
+	}
+
+	//其他Group开启的事务被忽略
+	executed = executed[:0]
+	if _, err := gb.ExecContext(ctx, "UPDATE `user` SET `is_on`=?", 1); err != nil || executed[0].Tx != nil {
+		t.Fatalf("foreign transaction should be ignored: %+v %v", executed[0], err)
+	}
+
+	executed = executed[:0]
+	err := gb.TransactionContext(ctx, nil, func(ctx context.Context, tx Transaction) error {
+		if tx != txB {
+			t.Fatal("foreign transaction should not be nested")
+		}
+		_, err := gb.ExecContext(ctx, "UPDATE `user` SET `is_on`=?", 1)
+		return err
+	})
+	if err != nil || len(executed) != 3 || executed[0].Op != OpBegin || executed[1].Tx != txB || executed[2].Op != OpCommit {
+		t.Fatalf("unexpected statements: %+v %v", executed, err)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	if _, err := NewMysqlGroup(&GroupOption{
+		Masters:     []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		RetryPolicy: &RetryPolicy{RetryOn: []string{"unknown"}},
+	}); err != ErrInvalidRetryOn {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters:     []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		RetryPolicy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	var (
+		attempts int
+		failure  error
+	)
+
+	mg.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		attempts++
+		return nil, failure
+	})
+
+	cases := []struct {
+		failure  error
+		ctx      context.Context
+		query    bool
+		attempts int
+	}{
+		{&mysql.MySQLError{Number: 1213}, context.Background(), false, 1},
+		{&mysql.MySQLError{Number: 1213}, WithIdempotent(context.Background()), false, 3},
+		{&mysql.MySQLError{Number: 1040}, context.Background(), false, 3},
+		{&mysql.MySQLError{Number: 1205}, context.Background(), true, 3},
+		{&mysql.MySQLError{Number: 1062}, context.Background(), true, 1},
+	}
+
+	for index, c := range cases {
+		attempts, failure = 0, c.failure
+		if c.query {
+			_, err = mg.QueryContext(c.ctx, true, "SELECT 1")
+		} else {
+			_, err = mg.ExecContext(c.ctx, "UPDATE `user` SET `is_on`=1")
+		}
+
+		if ErrorKind(err) != ErrorKind(c.failure) || attempts != c.attempts {
+			t.Fatalf("case %d: unexpected attempts %d, error %v", index, attempts, err)
+		}
+	}
+
+	jitter := 0.1
+	policy, _ := newRetryPolicy(&RetryPolicy{MaxAttempts: 10, InitialBackoff: 10, MaxBackoff: 50, Jitter: &jitter})
+	for attempt, expected := range []time.Duration{10, 20, 40, 50, 50} {
+		backoff := policy.backoff(attempt + 1)
+		if backoff < expected*time.Millisecond*9/10 || backoff > expected*time.Millisecond*11/10 {
+			t.Fatalf("unexpected backoff at %d: %v", attempt+1, backoff)
+		}
+	}
+
+	if policy, _ = newRetryPolicy(&RetryPolicy{}); policy.jitter != 0.2 {
+		t.Fatalf("unexpected default jitter: %v", policy.jitter)
+	}
+
+	jitter = 0
+	policy, _ = newRetryPolicy(&RetryPolicy{InitialBackoff: 10, Jitter: &jitter})
+	if backoff := policy.backoff(1); backoff != 10*time.Millisecond {
+		t.Fatalf("jitter should be disabled: %v", backoff)
+	}
+}
+
+func TestExecFailover(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}, {Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	var (
+		calls int
+		cause error
+	)
+
+	mg.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		calls++
+		return nil, cause
+	})
+
+	//读取响应失败时语句可能已执行，不切换主库
+	calls, cause = 0, &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+	if _, err = mg.Exec("UPDATE `user` SET `is_on`=?", 1); !errors.Is(err, ErrConnection) || calls != 1 {
+		t.Fatalf("unexpected failover: %d %v", calls, err)
+	}
+
+	calls, cause = 0, mysql.ErrInvalidConn
+	if _, err = mg.Exec("UPDATE `user` SET `is_on`=?", 1); !errors.Is(err, ErrConnection) || calls != 1 {
+		t.Fatalf("unexpected failover: %d %v", calls, err)
+	}
+
+	calls = 0
+	if _, err = mg.ExecContext(WithIdempotent(context.Background()), "UPDATE `user` SET `is_on`=?", 1); err != ErrNoMasterConn || calls != 2 {
+		t.Fatalf("idempotent exec should fail over: %d %v", calls, err)
+	}
+
+	calls, cause = 0, driver.ErrBadConn
+	if _, err = mg.Exec("UPDATE `user` SET `is_on`=?", 1); err != ErrNoMasterConn || calls != 2 {
+		t.Fatalf("unsent exec should fail over: %d %v", calls, err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	mg, err := NewMysqlGroup(&GroupOption{
+		Masters: []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		Slaves:  []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}, {Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		CircuitBreaker: &BreakerOption{
+			MinRequests:   4,
+			ErrorRate:     0.5,
+			SlowThreshold: 100,
+			SlowRate:      0.5,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mg.Close()
+
+	var (
+		gp     = mg.(*group)
+		events []StateEvent
+		start  = time.Now()
+	)
+
+	mg.OnStateChange(func(event StateEvent) {
+		events = append(events, event)
+	})
+
+	//业务错误不计入
+	for i := 0; i < 4; i++ {
+		gp.record(RoleSlave, 0, start, &mysql.MySQLError{Number: 1062})
+	}
+
+	if gp.slaveBreakers[0].State() != BreakerClosed {
+		t.Fatal("business errors should not trip the breaker")
+	}
+
+	gp.record(RoleSlave, 0, start, driver.ErrBadConn)
+	gp.record(RoleSlave, 0, start, context.DeadlineExceeded)
+	gp.record(RoleSlave, 0, start, driver.ErrBadConn)
+	gp.record(RoleSlave, 0, start, driver.ErrBadConn)
+
+	if gp.slaveBreakers[0].State() != BreakerOpen || len(events) != 1 || events[0].Up {
+		t.Fatalf("breaker should be open: %s %+v", gp.slaveBreakers[0].State(), events)
+	}
+
+	if bad := mg.BadPool(false); len(bad) != 1 || bad[0] != 0 {
+		t.Fatalf("unexpected bad pool: %v", bad)
+	}
+
+	for i := 0; i < 4; i++ {
+		if index, _, _, _ := gp.getSlave(0); index != 1 {
+			t.Fatalf("tripped slave selected")
+		}
+	}
+
+	//熔断超时，进入半开状态探测
+	gp.slaveBreakers[0].openedAt = time.Now().Add(-time.Minute)
+	gp.slaveBreakers[1].record(time.Now(), 0, nil)
+
+	selected := map[int]bool{}
+	for i := 0; i < 4; i++ {
+		index, _, _, _ := gp.getSlave(0)
+		selected[index] = true
+	}
+
+	if !selected[0] || gp.slaveBreakers[0].State() != BreakerHalfOpen {
+		t.Fatalf("half-open slave should be probed: %v %s", selected, gp.slaveBreakers[0].State())
+	}
+
+	gp.record(RoleSlave, 0, time.Now(), nil)
+	if gp.slaveBreakers[0].State() != BreakerClosed || len(events) != 2 || !events[1].Up {
+		t.Fatalf("breaker should be closed: %s %+v", gp.slaveBreakers[0].State(), events)
+	}
+
+	//慢请求熔断
+	for i := 0; i < 4; i++ {
+		gp.record(RoleMaster, 0, time.Now().Add(-time.Second), nil)
+	}
+
+	if stats := mg.Stats(); stats[0].Breaker != BreakerOpen || !stats[0].Bad {
+		t.Fatalf("slow master should be tripped: %+v", stats[0])
+	}
+
+	//所有主库均熔断时仍使用主库
+	if index, pool, _ := gp.getMaster(); index != 0 || pool == nil {
+		t.Fatalf("tripped master should be used as last resort: %d", index)
+	}
+
+	//单个从库熔断时回退到主库
+	single, err := NewMysqlGroup(&GroupOption{
+		Masters:        []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		Slaves:         []PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+		CircuitBreaker: &BreakerOption{MinRequests: 1, ErrorRate: 0.5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.Close()
+
+	sg := single.(*group)
+	sg.record(RoleSlave, 0, time.Now(), driver.ErrBadConn)
+	if _, _, _, ok := sg.getSlave(0); ok {
+		t.Fatal("tripped slave should not be selected")
+	}
+
+	var executed *Statement
+	single.Use(func(ctx context.Context, stmt *Statement, invoker Invoker) (*Reply, error) {
+		executed = stmt
+		return nil, errors.New("done")
+	})
+
+	_, _ = single.Query(false, "SELECT 1")
+	if executed == nil || executed.Role != RoleMaster {
+		t.Fatalf("query should fall back to master: %+v", executed)
+	}
+
+	//所有连接池均熔断且被标记为坏连接池，熔断超时后仍进入半开状态探测
+	sg.retryInterval = 3600
+	sg.record(RoleMaster, 0, time.Now(), driver.ErrBadConn)
+	sg.down(0, true)
+	sg.down(0, false)
+	sg.masterBreakers[0].openedAt = time.Now().Add(-time.Minute)
+	sg.slaveBreakers[0].openedAt = time.Now().Add(-time.Minute)
+
+	if _, pool, _, ok := sg.getSlave(0); !ok || pool == nil || sg.slaveBreakers[0].State() != BreakerHalfOpen {
+		t.Fatalf("tripped slave should be probed: %v %s", ok, sg.slaveBreakers[0].State())
+	}
+
+	if _, _, _, ok := sg.getSlave(0); ok {
+		t.Fatal("only one probe should be in flight")
+	}
+
+	if sg.getMaster(); sg.masterBreakers[0].State() != BreakerHalfOpen {
+		t.Fatalf("tripped master should be probed: %s", sg.masterBreakers[0].State())
+	}
+
+	//熔断前开始的请求不计入探测结果
+	sg.record(RoleSlave, 0, time.Now().Add(-time.Hour), nil)
+	if sg.slaveBreakers[0].State() != BreakerHalfOpen {
+		t.Fatalf("stale result should be ignored: %s", sg.slaveBreakers[0].State())
+	}
+
+	sg.record(RoleSlave, 0, time.Now(), nil)
+	if sg.slaveBreakers[0].State() != BreakerClosed {
+		t.Fatalf("probe result should close the breaker: %s", sg.slaveBreakers[0].State())
+	}
+
+	//并发获取时只发放一个探测许可
+	b := newBreaker(&BreakerOption{}, nil)
+	b.state, b.openedAt = BreakerOpen, time.Now().Add(-time.Minute)
+
+	acquired := make(chan bool, 16)
+	for i := 0; i < cap(acquired); i++ {
+		go func() {
+			acquired <- b.tryAcquire(time.Now())
+		}()
+	}
+
+	probes := 0
+	for i := 0; i < cap(acquired); i++ {
+		if <-acquired {
+			probes++
+		}
+	}
+
+	if probes != 1 {
+		t.Fatalf("unexpected probes: %d", probes)
+	}
+}
+
+func TestManager(t *testing.T) {
+	yamlConf := `
+user:
+  retryInterval: 60
+  masters:
+    - dsn: root:123456@tcp(127.0.0.1:3306)/user
+  slaves:
+    - dsn: root:123456@tcp(127.0.0.1:3306)/user
+      weight: 2
+order:
+  masters:
+    - dsn: root:123456@tcp(127.0.0.1:3306)/order
+`
+
+	manager, err := NewManagerFromReader(strings.NewReader(yamlConf), FormatYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := manager.Names(); len(names) != 2 || names[0] != "order" || names[1] != "user" {
+		t.Fatalf("unexpected names: %v", names)
+	}
+
+	if len(manager.groups) != 0 {
+		t.Fatal("groups should be created lazily")
+	}
+
+	user, err := manager.Get("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again, _ := manager.Get("user"); again != user {
+		t.Fatal("group should be cached")
+	}
+
+	if stats := user.Stats(); len(stats) != 2 || user.(*group).slaveNodes[0].Weight != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if _, err = manager.Get("missing"); err != ErrGroupNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err = manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = manager.Get("user"); err != ErrManagerClosed {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	jsonConf := `{"user":{"masters":[{"dsn":"root:123456@tcp(127.0.0.1:3306)/user"}]}}`
+	if manager, err = NewManagerFromReader(strings.NewReader(jsonConf), FormatJson); err != nil {
+		t.Fatal(err)
+	}
+	_ = manager.Close()
+
+	invalid := map[string]error{
+		`{"user":{"masters":[{"dsn":" "}]}}`:                                           ErrEmptyDsn,
+		`{"user":{"masters":[{"dsn":"a"}],"slaves":[{"dsn":""}]}}`:                     ErrEmptyDsn,
+		`{"user":{"masters":[{"dsn":"a"}],"retryInterval":-1}}`:                        ErrInvalidRetryInterval,
+		`{"user":{"slaves":[{"dsn":"a"}]}}`:                                            ErrNoMasters,
+		`{"user":{"masters":[{"dsn":"a"}],"balancer":"unknown"}}`:                      ErrUnknownBalancer,
+		`{"user":{"masters":[{"dsn":"a","maxOpenConns":-1}]}}`:                         ErrInvalidOption,
+		`{"user":{"masters":[{"dsn":"a"}],"retryPolicy":{"retryOn":["x"]}}}`:           ErrInvalidRetryOn,
+		`{"user":{"masters":[{"dsn":"a"}],"replicationLag":{"interval":-1}}}`:          ErrInvalidOption,
+		`{"user":{"masters":[{"dsn":"a"}],"replicationLag":{"heartbeatTable":"a b"}}}`: ErrInvalidHeartbeat,
+		`{"user":{"masters":[{"dsn":"a"}],"circuitBreaker":{"openTimeout":-1}}}`:       ErrInvalidOption,
+		`{"user":{"masters":[{"dsn":"a"}],"circuitBreaker":{"errorRate":1.5}}}`:        ErrInvalidOption,
+	}
+
+	for conf, expected := range invalid {
+		if _, err = NewManagerFromReader(strings.NewReader(conf), FormatJson); !errors.Is(err, expected) {
+			t.Fatalf("unexpected error for %s: %v", conf, err)
+		}
+	}
+
+	if _, err = NewManagerFromReader(strings.NewReader(jsonConf), "toml"); err != ErrInvalidFormat {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 func TestTransaction_Commit(t *testing.T) {
 	tx, err := g.Begin()
 	if err != nil {
@@ -0,0 +1,190 @@
+// Package otelorm 为orm.Group和orm.Transaction提供OpenTelemetry链路追踪
+//
+//	group.Use(otelorm.Interceptor())
+package otelorm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/grpc-boot/orm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = `github.com/grpc-boot/orm/otelorm`
+)
+
+// 属性名
+const (
+	DbSystem     = attribute.Key(`db.system`)
+	DbStatement  = attribute.Key(`db.statement`)
+	DbOperation  = attribute.Key(`db.operation`)
+	PoolRole     = attribute.Key(`db.orm.pool.role`)
+	PoolIndex    = attribute.Key(`db.orm.pool.index`)
+	RowsAffected = attribute.Key(`db.orm.rows_affected`)
+	InTx         = attribute.Key(`db.orm.transaction`)
+)
+
+type config struct {
+	provider   trace.TracerProvider
+	attributes []attribute.KeyValue
+	normalize  func(sqlStr string) string
+}
+
+// Option 配置项
+type Option func(conf *config)
+
+// WithTracerProvider 指定TracerProvider，默认为otel.GetTracerProvider()
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(conf *config) {
+		conf.provider = provider
+	}
+}
+
+// WithAttributes 为所有span附加属性，如db.name
+func WithAttributes(attributes ...attribute.KeyValue) Option {
+	return func(conf *config) {
+		conf.attributes = append(conf.attributes, attributes...)
+	}
+}
+
+// WithNormalizer 指定db.statement的规范化函数，默认为Normalize
+func WithNormalizer(normalize func(sqlStr string) string) Option {
+	return func(conf *config) {
+		conf.normalize = normalize
+	}
+}
+
+// Interceptor 为每个Query/Exec/Begin/Commit/Rollback创建span，父span取自ctx
+func Interceptor(opts ...Option) orm.Interceptor {
+	conf := &config{
+		normalize: Normalize,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	if conf.provider == nil {
+		conf.provider = otel.GetTracerProvider()
+	}
+
+	tracer := conf.provider.Tracer(instrumentationName)
+
+	return func(ctx context.Context, stmt *orm.Statement, invoker orm.Invoker) (*orm.Reply, error) {
+		attributes := make([]attribute.KeyValue, 0, 6+len(conf.attributes))
+		attributes = append(attributes,
+			DbSystem.String(`mysql`),
+			DbOperation.String(string(stmt.Op)),
+			DbStatement.String(conf.normalize(stmt.Sql)),
+			PoolRole.String(stmt.Role),
+			PoolIndex.Int(stmt.Index),
+			InTx.Bool(stmt.Tx != nil),
+		)
+		attributes = append(attributes, conf.attributes...)
+
+		ctx, span := tracer.Start(ctx, `orm.`+string(stmt.Op),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attributes...),
+		)
+		defer span.End()
+
+		reply, err := invoker(ctx, stmt)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return reply, err
+		}
+
+		if reply != nil && reply.Result != nil {
+			if rows, e := reply.Result.RowsAffected(); e == nil {
+				span.SetAttributes(RowsAffected.Int64(rows))
+			}
+		}
+
+		return reply, nil
+	}
+}
+
+// Normalize 规范化sql：合并空白字符，将字符串和数字字面量替换为?
+func Normalize(sqlStr string) string {
+	var (
+		buf   strings.Builder
+		space bool
+	)
+
+	buf.Grow(len(sqlStr))
+
+	for index := 0; index < len(sqlStr); index++ {
+		char := sqlStr[index]
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			space = buf.Len() > 0
+			continue
+		case char == '\'' || char == '"':
+			//跳过字符串字面量，支持反斜杠和重复引号转义
+			for index++; index < len(sqlStr); index++ {
+				if sqlStr[index] == '\\' {
+					index++
+					continue
+				}
+
+				if sqlStr[index] == char {
+					if index+1 < len(sqlStr) && sqlStr[index+1] == char {
+						index++
+						continue
+					}
+					break
+				}
+			}
+			char = '?'
+		case char == '`':
+			//保留标识符
+			end := len(sqlStr)
+			if offset := strings.IndexByte(sqlStr[index+1:], '`'); offset >= 0 {
+				end = index + offset + 2
+			}
+
+			if space {
+				buf.WriteByte(' ')
+				space = false
+			}
+			buf.WriteString(sqlStr[index:end])
+			index = end - 1
+			continue
+		case char >= '0' && char <= '9' && !isIdentByte(prevByte(sqlStr, index)):
+			for index+1 < len(sqlStr) && (isDigit(sqlStr[index+1]) || sqlStr[index+1] == '.') {
+				index++
+			}
+			char = '?'
+		}
+
+		if space {
+			buf.WriteByte(' ')
+			space = false
+		}
+		buf.WriteByte(char)
+	}
+
+	return buf.String()
+}
+
+func prevByte(sqlStr string, index int) byte {
+	if index == 0 {
+		return ' '
+	}
+	return sqlStr[index-1]
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+func isIdentByte(char byte) bool {
+	return char == '_' || char == '$' || isDigit(char) || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+}
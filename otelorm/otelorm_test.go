@@ -0,0 +1,221 @@
+package otelorm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/grpc-boot/orm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type result int64
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+func attributeMap(attributes []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	m := make(map[attribute.Key]attribute.Value, len(attributes))
+	for _, kv := range attributes {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestInterceptor(t *testing.T) {
+	var (
+		recorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		failed   = errors.New("failed")
+	)
+
+	group, err := orm.NewMysqlGroup(&orm.GroupOption{
+		Masters: []orm.PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:3306)/dd`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer group.Close()
+
+	group.Use(Interceptor(WithTracerProvider(provider)), func(ctx context.Context, stmt *orm.Statement, invoker orm.Invoker) (*orm.Reply, error) {
+		if stmt.Op == orm.OpQuery {
+			return nil, failed
+		}
+		return &orm.Reply{Result: result(2)}, nil
+	})
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	_, err = group.ExecContext(ctx, "UPDATE `user` SET `nickname`='a' WHERE `id` IN(1, 2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = group.QueryContext(ctx, true, "SELECT 1"); !errors.Is(err, failed) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("unexpected spans: %d", len(spans))
+	}
+
+	exec := spans[0]
+	if exec.Name() != "orm.exec" || exec.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("unexpected span: %s %v", exec.Name(), exec.Parent())
+	}
+
+	attributes := attributeMap(exec.Attributes())
+	if attributes[DbSystem].AsString() != "mysql" ||
+		attributes[DbStatement].AsString() != "UPDATE `user` SET `nickname`=? WHERE `id` IN(?, ?)" ||
+		attributes[PoolRole].AsString() != orm.RoleMaster ||
+		attributes[PoolIndex].AsInt64() != 0 ||
+		attributes[RowsAffected].AsInt64() != 2 {
+		t.Fatalf("unexpected attributes: %v", exec.Attributes())
+	}
+
+	query := spans[1]
+	if query.Name() != "orm.query" || query.Status().Code != codes.Error || len(query.Events()) != 1 {
+		t.Fatalf("unexpected span: %s %v", query.Name(), query.Status())
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"SELECT  *\n FROM `t1` WHERE id = 10 AND name = 'a''b' AND x = \"c\\\"d\"": "SELECT * FROM `t1` WHERE id = ? AND name = ? AND x = ?",
+		"SELECT `a1`, col2 FROM t3 LIMIT 0,10":                                     "SELECT `a1`, col2 FROM t3 LIMIT ?,?",
+		"  INSERT INTO `user`(`id`)VALUES(?) ":                                     "INSERT INTO `user`(`id`)VALUES(?)",
+		"SELECT 1.5 FROM `unclosed":                                                "SELECT ? FROM `unclosed",
+	}
+
+	for sqlStr, expected := range cases {
+		if normalized := Normalize(sqlStr); normalized != expected {
+			t.Fatalf("unexpected normalized sql: %s => %s", sqlStr, normalized)
+		}
+	}
+}
+
+// fakeServer 完成握手并对所有命令返回OK的MySQL服务端，用于开启和提交事务
+func fakeServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	var (
+		capabilities = uint32(0x00000001 | 0x00000200 | 0x00002000 | 0x00008000 | 0x00080000)
+		ok           = []byte{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+	)
+
+	handshake := []byte{0x0a}
+	handshake = append(handshake, "5.7.0\x00"...)
+	handshake = append(handshake, 1, 0, 0, 0)
+	handshake = append(handshake, "abcdefgh"...)
+	handshake = append(handshake, 0x00, byte(capabilities), byte(capabilities>>8), 33, 0x02, 0x00, byte(capabilities>>16), byte(capabilities>>24), 21)
+	handshake = append(handshake, make([]byte, 10)...)
+	handshake = append(handshake, "ijklmnopqrst\x00"...)
+	handshake = append(handshake, "mysql_native_password\x00"...)
+
+	write := func(conn net.Conn, seq byte, payload []byte) error {
+		header := make([]byte, 4)
+		binary.LittleEndian.PutUint32(header, uint32(len(payload)))
+		header[3] = seq
+		_, err := conn.Write(append(header, payload...))
+		return err
+	}
+
+	read := func(conn net.Conn) (seq byte, payload []byte, err error) {
+		header := make([]byte, 4)
+		if _, err = io.ReadFull(conn, header); err != nil {
+			return 0, nil, err
+		}
+
+		seq = header[3]
+		header[3] = 0
+		payload = make([]byte, binary.LittleEndian.Uint32(header))
+		_, err = io.ReadFull(conn, payload)
+		return seq, payload, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				if write(conn, 0, handshake) != nil {
+					return
+				}
+
+				for {
+					seq, payload, err := read(conn)
+					//COM_QUIT
+					if err != nil || (len(payload) > 0 && payload[0] == 0x01 && seq == 0) {
+						return
+					}
+
+					if write(conn, seq+1, ok) != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestTransactionSpans(t *testing.T) {
+	var (
+		recorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	)
+
+	group, err := orm.NewMysqlGroup(&orm.GroupOption{
+		Masters: []orm.PoolOption{{Dsn: `root:123456@tcp(` + fakeServer(t) + `)/dd?timeout=1s`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer group.Close()
+
+	group.Use(Interceptor(WithTracerProvider(provider)))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+	tx, err := group.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 || spans[0].Name() != "orm.begin" || spans[1].Name() != "orm.commit" {
+		t.Fatalf("unexpected spans: %d", len(spans))
+	}
+
+	for _, span := range spans[:2] {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Fatalf("span %s should be a child of the caller span", span.Name())
+		}
+	}
+}
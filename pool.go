@@ -15,6 +15,8 @@ type PoolOption struct {
 	MaxConnLifetime int `yaml:"maxConnLifetime" json:"maxConnLifetime"`
 	MaxOpenConns    int `yaml:"maxOpenConns" json:"maxOpenConns"`
 	MaxIdleConns    int `yaml:"maxIdleConns" json:"maxIdleConns"`
+	//权重，weighted负载均衡时使用，默认为1
+	Weight int `yaml:"weight" json:"weight"`
 }
 
 type Pool interface {
@@ -30,6 +32,12 @@ type Pool interface {
 	Begin() (Transaction, error)
 	// BeginTx with context 开启事务
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (Transaction, error)
+	// Ping 检查连接
+	Ping(ctx context.Context) (err error)
+	// Stats 连接池统计
+	Stats() sql.DBStats
+	// Close 关闭连接池
+	Close() (err error)
 }
 
 type mysqlPool struct {
@@ -73,7 +81,7 @@ func (mp *mysqlPool) Begin() (Transaction, error) {
 		return nil, err
 	}
 
-	return newTx(tx), err
+	return newTx(context.Background(), tx), err
 }
 
 func (mp *mysqlPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (Transaction, error) {
@@ -82,5 +90,97 @@ func (mp *mysqlPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (Transact
 		return nil, err
 	}
 
-	return newTx(tx), err
+	return newTx(ctx, tx), err
+}
+
+func (mp *mysqlPool) Ping(ctx context.Context) (err error) {
+	return mp.db.PingContext(ctx)
+}
+
+func (mp *mysqlPool) Stats() sql.DBStats {
+	return mp.db.Stats()
+}
+
+func (mp *mysqlPool) Close() (err error) {
+	return mp.db.Close()
+}
+
+// groupPool Group内的连接池，记录所属角色和序号，语句经过拦截器链执行并记录日志
+type groupPool struct {
+	Pool
+
+	g     *group
+	role  string
+	index int
+}
+
+func (gp *groupPool) statement(op Operation, sqlStr string, args []interface{}) *Statement {
+	return &Statement{
+		Op:    op,
+		Sql:   sqlStr,
+		Args:  args,
+		Role:  gp.role,
+		Index: gp.index,
+		Pool:  gp.Pool,
+	}
+}
+
+func (gp *groupPool) Query(sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
+	return gp.QueryContext(context.Background(), sqlStr, args...)
+}
+
+func (gp *groupPool) QueryContext(ctx context.Context, sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
+	reply, err := gp.g.invoke(ctx, gp.statement(OpQuery, sqlStr, args), gp.do)
+	return reply.Rows, err
+}
+
+func (gp *groupPool) Exec(sqlStr string, args ...interface{}) (result sql.Result, err error) {
+	return gp.ExecContext(context.Background(), sqlStr, args...)
+}
+
+func (gp *groupPool) ExecContext(ctx context.Context, sqlStr string, args ...interface{}) (result sql.Result, err error) {
+	reply, err := gp.g.invoke(ctx, gp.statement(OpExec, sqlStr, args), gp.do)
+	return reply.Result, err
+}
+
+func (gp *groupPool) Begin() (Transaction, error) {
+	return gp.BeginTx(context.Background(), nil)
+}
+
+func (gp *groupPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (Transaction, error) {
+	stmt := gp.statement(OpBegin, `BEGIN`, nil)
+	stmt.TxOptions = opts
+
+	reply, err := gp.g.invoke(ctx, stmt, gp.do)
+	//事务内的语句使用调用方的ctx，而不是经过拦截器后的ctx
+	if t, ok := reply.Tx.(*transaction); ok {
+		t.ctx = ctx
+	}
+	return reply.Tx, err
+}
+
+// do 拦截器链末端，在连接池上执行语句
+func (gp *groupPool) do(ctx context.Context, stmt *Statement) (reply *Reply, err error) {
+	var (
+		start = time.Now()
+	)
+
+	reply = &Reply{}
+	switch stmt.Op {
+	case OpQuery:
+		reply.Rows, err = gp.Pool.QueryContext(ctx, stmt.Sql, stmt.Args...)
+	case OpExec:
+		reply.Result, err = gp.Pool.ExecContext(ctx, stmt.Sql, stmt.Args...)
+	case OpBegin:
+		reply.Tx, err = gp.Pool.BeginTx(ctx, stmt.TxOptions)
+		if t, ok := reply.Tx.(*transaction); ok {
+			t.group, t.pool, t.role, t.index = gp.g, gp.Pool, gp.role, gp.index
+		}
+	default:
+		return reply, ErrInvalidOperation
+	}
+
+	gp.g.record(gp.role, gp.index, start, err)
+	gp.g.logStatement(ctx, gp.role, gp.index, stmt.Sql, stmt.Args, start, reply.Result, err)
+	return reply, err
 }
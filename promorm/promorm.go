@@ -0,0 +1,245 @@
+// Package promorm 为orm.Group提供Prometheus指标
+//
+//	prometheus.MustRegister(promorm.New("user", group))
+package promorm
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grpc-boot/orm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = `orm`
+)
+
+// 错误分类标签
+const (
+	ClassDuplicateKey = `duplicate_key`
+	ClassDeadlock     = `deadlock`
+	ClassLockTimeout  = `lock_timeout`
+	ClassReadOnly     = `read_only`
+	ClassConnection   = `connection`
+	ClassTooManyConns = `too_many_connections`
+	ClassNotFound     = `not_found`
+	ClassOther        = `other`
+)
+
+type config struct {
+	buckets []float64
+	table   func(sqlStr string) string
+}
+
+// Option 配置项
+type Option func(conf *config)
+
+// WithBuckets 语句耗时直方图的桶，单位s，默认为prometheus.DefBuckets
+func WithBuckets(buckets []float64) Option {
+	return func(conf *config) {
+		conf.buckets = buckets
+	}
+}
+
+// WithTableFunc 指定从sql中提取表名的函数，默认为Table，返回空字符串可降低标签基数
+func WithTableFunc(table func(sqlStr string) string) Option {
+	return func(conf *config) {
+		conf.table = table
+	}
+}
+
+// Collector Group指标收集器，实现prometheus.Collector
+type Collector struct {
+	group orm.Group
+	table func(sqlStr string) string
+
+	latency   *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+	failovers *prometheus.CounterVec
+
+	up              *prometheus.Desc
+	lag             *prometheus.Desc
+	maxOpen         *prometheus.Desc
+	open            *prometheus.Desc
+	inUse           *prometheus.Desc
+	idle            *prometheus.Desc
+	waitCount       *prometheus.Desc
+	waitDuration    *prometheus.Desc
+	maxIdleClosed   *prometheus.Desc
+	maxIdleTimeout  *prometheus.Desc
+	maxLifetimeDone *prometheus.Desc
+}
+
+// New 创建名为name的Group的指标收集器，并在group上注册拦截器和状态观察者
+func New(name string, group orm.Group, opts ...Option) *Collector {
+	conf := &config{
+		buckets: prometheus.DefBuckets,
+		table:   Table,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	var (
+		constLabels = prometheus.Labels{"group": name}
+		poolLabels  = []string{"role", "index"}
+	)
+
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", name), help, poolLabels, constLabels)
+	}
+
+	c := &Collector{
+		group: group,
+		table: conf.table,
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "statement_duration_seconds",
+			Help:        "Statement latency by operation and table.",
+			ConstLabels: constLabels,
+			Buckets:     conf.buckets,
+		}, []string{"operation", "table"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "statement_errors_total",
+			Help:        "Statement errors by operation and MySQL error class.",
+			ConstLabels: constLabels,
+		}, []string{"operation", "class"}),
+		failovers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "pool_state_changes_total",
+			Help:        "Pool up/down transitions.",
+			ConstLabels: constLabels,
+		}, []string{"role", "index", "state"}),
+		up:              desc("up", "Whether the pool is healthy (1) or marked bad (0)."),
+		lag:             desc("replication_lag_seconds", "Replication lag of the slave pool."),
+		maxOpen:         desc("max_open_connections", "Maximum number of open connections."),
+		open:            desc("open_connections", "Number of established connections."),
+		inUse:           desc("in_use_connections", "Number of connections currently in use."),
+		idle:            desc("idle_connections", "Number of idle connections."),
+		waitCount:       desc("wait_count_total", "Total number of connections waited for."),
+		waitDuration:    desc("wait_duration_seconds_total", "Total time blocked waiting for a new connection."),
+		maxIdleClosed:   desc("max_idle_closed_total", "Total number of connections closed due to SetMaxIdleConns."),
+		maxIdleTimeout:  desc("max_idle_time_closed_total", "Total number of connections closed due to SetConnMaxIdleTime."),
+		maxLifetimeDone: desc("max_lifetime_closed_total", "Total number of connections closed due to SetConnMaxLifetime."),
+	}
+
+	group.Use(c.intercept)
+	group.OnStateChange(c.observe)
+
+	return c
+}
+
+// Describe 实现prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.latency.Describe(ch)
+	c.errors.Describe(ch)
+	c.failovers.Describe(ch)
+
+	for _, desc := range []*prometheus.Desc{
+		c.up, c.lag, c.maxOpen, c.open, c.inUse, c.idle, c.waitCount,
+		c.waitDuration, c.maxIdleClosed, c.maxIdleTimeout, c.maxLifetimeDone,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect 实现prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.latency.Collect(ch)
+	c.errors.Collect(ch)
+	c.failovers.Collect(ch)
+
+	for _, pool := range c.group.Stats() {
+		var (
+			labels = []string{pool.Role, strconv.Itoa(pool.Index)}
+			stats  = pool.Stats
+			up     = 1.0
+		)
+
+		if pool.Bad {
+			up = 0
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, labels...)
+		if pool.Role == orm.RoleSlave {
+			ch <- prometheus.MustNewConstMetric(c.lag, prometheus.GaugeValue, float64(pool.Lag)/1000, labels...)
+		}
+		ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections), labels...)
+		ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections), labels...)
+		ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse), labels...)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle), labels...)
+		ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount), labels...)
+		ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), labels...)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed), labels...)
+		ch <- prometheus.MustNewConstMetric(c.maxIdleTimeout, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), labels...)
+		ch <- prometheus.MustNewConstMetric(c.maxLifetimeDone, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), labels...)
+	}
+}
+
+func (c *Collector) intercept(ctx context.Context, stmt *orm.Statement, invoker orm.Invoker) (*orm.Reply, error) {
+	start := time.Now()
+	reply, err := invoker(ctx, stmt)
+
+	operation := string(stmt.Op)
+	c.latency.WithLabelValues(operation, c.table(stmt.Sql)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.errors.WithLabelValues(operation, Class(err)).Inc()
+	}
+
+	return reply, err
+}
+
+func (c *Collector) observe(event orm.StateEvent) {
+	state := `down`
+	if event.Up {
+		state = `up`
+	}
+
+	c.failovers.WithLabelValues(event.Role, strconv.Itoa(event.Index), state).Inc()
+}
+
+// Class 错误分类标签
+func Class(err error) string {
+	switch orm.ErrorKind(err) {
+	case orm.ErrDuplicateKey:
+		return ClassDuplicateKey
+	case orm.ErrDeadlock:
+		return ClassDeadlock
+	case orm.ErrLockTimeout:
+		return ClassLockTimeout
+	case orm.ErrReadOnly:
+		return ClassReadOnly
+	case orm.ErrConnection:
+		return ClassConnection
+	case orm.ErrTooManyConns:
+		return ClassTooManyConns
+	case orm.ErrNotFound:
+		return ClassNotFound
+	}
+	return ClassOther
+}
+
+// Table 提取sql中FROM、INTO、UPDATE、TABLE后的第一个表名，未找到时返回空字符串
+func Table(sqlStr string) string {
+	fields := strings.Fields(sqlStr)
+	for index := 0; index < len(fields)-1; index++ {
+		switch strings.ToUpper(fields[index]) {
+		case "FROM", "INTO", "UPDATE", "TABLE":
+			return tableName(fields[index+1])
+		}
+	}
+	return ""
+}
+
+func tableName(token string) string {
+	//去除紧随表名的字段列表，如：`user`(`id`,`name`)
+	if end := strings.IndexAny(token, "(,;"); end >= 0 {
+		token = token[:end]
+	}
+	return strings.ReplaceAll(token, "`", "")
+}
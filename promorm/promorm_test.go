@@ -0,0 +1,83 @@
+package promorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/grpc-boot/orm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type result int64
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+func TestCollector(t *testing.T) {
+	group, err := orm.NewMysqlGroup(&orm.GroupOption{
+		Masters: []orm.PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:1)/dd?timeout=1s`}},
+		Slaves:  []orm.PoolOption{{Dsn: `root:123456@tcp(127.0.0.1:1)/dd?timeout=1s`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer group.Close()
+
+	collector := New("user", group)
+
+	group.Use(func(ctx context.Context, stmt *orm.Statement, invoker orm.Invoker) (*orm.Reply, error) {
+		if stmt.Op == orm.OpExec {
+			return nil, &mysql.MySQLError{Number: 1062}
+		}
+		return &orm.Reply{Result: result(1)}, nil
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	_, _ = group.Exec("INSERT INTO `user`(`id`)VALUES(?)", 1)
+	_ = group.Ping(context.Background())
+
+	if count := testutil.ToFloat64(collector.errors.WithLabelValues("exec", ClassDuplicateKey)); count != 1 {
+		t.Fatalf("unexpected error count: %v", count)
+	}
+
+	if count := testutil.CollectAndCount(collector.latency, "orm_statement_duration_seconds"); count != 1 {
+		t.Fatalf("unexpected histogram count: %d", count)
+	}
+
+	if count := testutil.ToFloat64(collector.failovers.WithLabelValues(orm.RoleMaster, "0", "down")); count != 1 {
+		t.Fatalf("unexpected failover count: %v", count)
+	}
+
+	if count, err := testutil.GatherAndCount(registry, "orm_pool_up", "orm_pool_replication_lag_seconds"); err != nil || count != 3 {
+		t.Fatalf("unexpected pool metrics: %d %v", count, err)
+	}
+
+	if problems, err := testutil.CollectAndLint(collector); err != nil || len(problems) > 0 {
+		t.Fatalf("lint: %v %v", problems, err)
+	}
+}
+
+func TestTable(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM `user` WHERE `id`=?":     "user",
+		"INSERT INTO `user`(`id`)VALUES(?)":     "user",
+		"UPDATE user SET `is_on`=?":             "user",
+		"DELETE FROM `dd`.`order` WHERE id = ?": "dd.order",
+		"BEGIN":                                 "",
+	}
+
+	for sqlStr, expected := range cases {
+		if table := Table(sqlStr); table != expected {
+			t.Fatalf("unexpected table: %s => %s", sqlStr, table)
+		}
+	}
+}
@@ -14,12 +14,67 @@ var (
 	}
 )
 
+const (
+	innerJoin = ` INNER JOIN `
+	leftJoin  = ` LEFT JOIN `
+	rightJoin = ` RIGHT JOIN `
+	crossJoin = ` CROSS JOIN `
+)
+
+type join struct {
+	kind  string
+	table string
+	alias string
+	on    []Condition
+}
+
+func (j *join) sql(arguments *[]interface{}) string {
+	var (
+		sqlBuffer strings.Builder
+		hasOn     bool
+	)
+
+	sqlBuffer.WriteString(j.kind)
+	sqlBuffer.WriteString(j.table)
+	if j.alias != "" {
+		sqlBuffer.WriteString(" AS ")
+		sqlBuffer.WriteString(j.alias)
+	}
+
+	for _, condition := range j.on {
+		sqlStr := condition.Sql(arguments)
+		if sqlStr == "" {
+			continue
+		}
+
+		if hasOn {
+			sqlBuffer.WriteString(" AND ")
+		} else {
+			hasOn = true
+			sqlBuffer.WriteString(" ON ")
+		}
+		sqlBuffer.WriteString(sqlStr)
+	}
+
+	return sqlBuffer.String()
+}
+
 // Query Query对象
 type Query interface {
 	// Select Select表达式
 	Select(columns ...string) Query
+	// SelectExpr 追加Expression列，如：SelectExpr(Expr("IF(`is_on`=?, 'on', 'off') AS `state`", 1))
+	SelectExpr(exprs ...Expression) Query
 	// From From表达式
 	From(table string) Query
+	// Join Inner Join表达式
+	Join(table string, alias string, on ...Condition) Query
+	// LeftJoin Left Join表达式
+	LeftJoin(table string, alias string, on ...Condition) Query
+	// RightJoin Right Join表达式
+	RightJoin(table string, alias string, on ...Condition) Query
+	// CrossJoin Cross Join表达式
+	CrossJoin(table string, alias string, on ...Condition) Query
 	// Where Where表达式
 	Where(where Where) Query
 	// And 附加And where
@@ -52,7 +107,8 @@ type mysqlQuery struct {
 
 	g       Group
 	table   string
-	columns string
+	joins   []join
+	columns []interface{}
 	where   Where
 	group   string
 	having  string
@@ -64,7 +120,8 @@ type mysqlQuery struct {
 func (mq *mysqlQuery) reset() Query {
 	mq.g = nil
 	mq.table = ""
-	mq.columns = ""
+	mq.joins = mq.joins[:0]
+	mq.columns = mq.columns[:0]
 	mq.offset = 0
 	mq.limit = 0
 	mq.group = ""
@@ -79,7 +136,17 @@ func (mq *mysqlQuery) reset() Query {
 }
 
 func (mq *mysqlQuery) Select(columns ...string) Query {
-	mq.columns = strings.Join(columns, ",")
+	mq.columns = mq.columns[:0]
+	for _, column := range columns {
+		mq.columns = append(mq.columns, column)
+	}
+	return mq
+}
+
+func (mq *mysqlQuery) SelectExpr(exprs ...Expression) Query {
+	for _, expr := range exprs {
+		mq.columns = append(mq.columns, expr)
+	}
 	return mq
 }
 
@@ -88,6 +155,32 @@ func (mq *mysqlQuery) From(table string) Query {
 	return mq
 }
 
+func (mq *mysqlQuery) Join(table string, alias string, on ...Condition) Query {
+	return mq.join(innerJoin, table, alias, on)
+}
+
+func (mq *mysqlQuery) LeftJoin(table string, alias string, on ...Condition) Query {
+	return mq.join(leftJoin, table, alias, on)
+}
+
+func (mq *mysqlQuery) RightJoin(table string, alias string, on ...Condition) Query {
+	return mq.join(rightJoin, table, alias, on)
+}
+
+func (mq *mysqlQuery) CrossJoin(table string, alias string, on ...Condition) Query {
+	return mq.join(crossJoin, table, alias, on)
+}
+
+func (mq *mysqlQuery) join(kind, table, alias string, on []Condition) Query {
+	mq.joins = append(mq.joins, join{
+		kind:  kind,
+		table: table,
+		alias: alias,
+		on:    on,
+	})
+	return mq
+}
+
 func (mq *mysqlQuery) Where(where Where) Query {
 	mq.where = where
 	return mq
@@ -141,15 +234,30 @@ func (mq *mysqlQuery) Sql(arguments *[]interface{}) (sql string) {
 
 	sqlBuffer.WriteString(`SELECT `)
 
-	if mq.columns == "" {
+	if len(mq.columns) == 0 {
 		sqlBuffer.WriteString("*")
-	} else {
-		sqlBuffer.WriteString(mq.columns)
+	}
+
+	for index, column := range mq.columns {
+		if index > 0 {
+			sqlBuffer.WriteByte(',')
+		}
+
+		switch val := column.(type) {
+		case Expression:
+			sqlBuffer.WriteString(val.Sql(arguments))
+		case string:
+			sqlBuffer.WriteString(val)
+		}
 	}
 
 	sqlBuffer.WriteString(` FROM `)
 	sqlBuffer.WriteString(mq.table)
 
+	for index := range mq.joins {
+		sqlBuffer.WriteString(mq.joins[index].sql(arguments))
+	}
+
 	if mq.where != nil && mq.where.HasWhere() {
 		whereStr = mq.where.Sql(arguments)
 		sqlBuffer.WriteString(whereStr)
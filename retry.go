@@ -0,0 +1,159 @@
+package orm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// 可重试的错误类型，用于RetryPolicy.RetryOn
+const (
+	RetryConnection   = `connection`
+	RetryDeadlock     = `deadlock`
+	RetryLockTimeout  = `lockTimeout`
+	RetryTooManyConns = `tooManyConnections`
+)
+
+var (
+	ErrInvalidRetryOn = errors.New(`mysql group: invalid retryOn, only connection, deadlock, lockTimeout and tooManyConnections are supported`)
+)
+
+var retryKinds = map[string]error{
+	RetryConnection:   ErrConnection,
+	RetryDeadlock:     ErrDeadlock,
+	RetryLockTimeout:  ErrLockTimeout,
+	RetryTooManyConns: ErrTooManyConns,
+}
+
+// RetryPolicy 瞬时错误重试策略
+//
+// 查询对所有可重试错误重试；写操作默认仅在语句未发送到服务端时（如连接被拒绝、连接数过多）重试，
+// 通过WithIdempotent标记的写操作对所有可重试错误重试
+type RetryPolicy struct {
+	//最大执行次数，包含第一次执行，小于2时不重试
+	MaxAttempts int `yaml:"maxAttempts" json:"maxAttempts"`
+	//首次重试等待时间，单位ms，默认10
+	InitialBackoff int64 `yaml:"initialBackoff" json:"initialBackoff"`
+	//最大等待时间，单位ms，默认1000
+	MaxBackoff int64 `yaml:"maxBackoff" json:"maxBackoff"`
+	//等待时间增长倍数，默认2
+	Multiplier float64 `yaml:"multiplier" json:"multiplier"`
+	//等待时间随机浮动比例，取值0~1，未设置时为0.2，0为不浮动
+	Jitter *float64 `yaml:"jitter" json:"jitter"`
+	//可重试的错误类型：connection、deadlock、lockTimeout、tooManyConnections，为空时全部重试
+	RetryOn []string `yaml:"retryOn" json:"retryOn"`
+}
+
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	jitter         float64
+	kinds          []error
+}
+
+func newRetryPolicy(policy *RetryPolicy) (*retryPolicy, error) {
+	rp := &retryPolicy{
+		maxAttempts:    policy.MaxAttempts,
+		initialBackoff: 10 * time.Millisecond,
+		maxBackoff:     time.Second,
+		multiplier:     2,
+		jitter:         0.2,
+	}
+
+	if policy.InitialBackoff > 0 {
+		rp.initialBackoff = time.Duration(policy.InitialBackoff) * time.Millisecond
+	}
+
+	if policy.MaxBackoff > 0 {
+		rp.maxBackoff = time.Duration(policy.MaxBackoff) * time.Millisecond
+	}
+
+	if policy.Multiplier >= 1 {
+		rp.multiplier = policy.Multiplier
+	}
+
+	if policy.Jitter != nil && *policy.Jitter >= 0 && *policy.Jitter <= 1 {
+		rp.jitter = *policy.Jitter
+	}
+
+	retryOn := policy.RetryOn
+	if len(retryOn) == 0 {
+		retryOn = []string{RetryConnection, RetryDeadlock, RetryLockTimeout, RetryTooManyConns}
+	}
+
+	for _, name := range retryOn {
+		kind, exists := retryKinds[name]
+		if !exists {
+			return nil, ErrInvalidRetryOn
+		}
+		rp.kinds = append(rp.kinds, kind)
+	}
+
+	return rp, nil
+}
+
+// retryable 第attempt次执行失败后是否重试
+func (rp *retryPolicy) retryable(attempt int, err error, idempotent bool) bool {
+	if rp == nil || err == nil || attempt >= rp.maxAttempts {
+		return false
+	}
+
+	if !idempotent && !notSent(err) {
+		return false
+	}
+
+	kind := ErrorKind(err)
+	for _, retryKind := range rp.kinds {
+		if kind == retryKind {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 第attempt次执行失败后的等待时间
+func (rp *retryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(rp.initialBackoff)
+	for i := 1; i < attempt && backoff < float64(rp.maxBackoff); i++ {
+		backoff *= rp.multiplier
+	}
+
+	if backoff > float64(rp.maxBackoff) {
+		backoff = float64(rp.maxBackoff)
+	}
+
+	backoff *= 1 + rp.jitter*(2*rand.Float64()-1)
+	return time.Duration(backoff)
+}
+
+// wait 等待重试，ctx结束时返回false
+func (rp *retryPolicy) wait(ctx context.Context, attempt int) bool {
+	timer := time.NewTimer(rp.backoff(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// notSent 语句未发送到服务端的错误：连接失效、建立连接失败或服务端拒绝连接
+func notSent(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == `dial` {
+		return true
+	}
+
+	return ErrorKind(err) == ErrTooManyConns
+}
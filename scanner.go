@@ -0,0 +1,178 @@
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	timeLayouts = []string{
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02T15:04:05.999999999Z07:00",
+		"2006-01-02",
+	}
+)
+
+// fieldScanner 将数据库列值写入结构体字段，NULL写入零值或nil指针
+type fieldScanner struct {
+	field reflect.Value
+}
+
+// Scan 实现sql.Scanner
+func (fs fieldScanner) Scan(src interface{}) error {
+	return setField(fs.field, src)
+}
+
+// scanDest 获取字段的扫描目标
+func scanDest(field reflect.Value) interface{} {
+	if field.Kind() != reflect.Ptr && reflect.PtrTo(field.Type()).Implements(scannerType) {
+		return field.Addr().Interface()
+	}
+	return fieldScanner{field: field}
+}
+
+func setField(field reflect.Value, src interface{}) error {
+	if src == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if scanner, ok := elem.Interface().(sql.Scanner); ok {
+			if err := scanner.Scan(src); err != nil {
+				return err
+			}
+		} else if err := setField(elem.Elem(), src); err != nil {
+			return err
+		}
+
+		field.Set(elem)
+		return nil
+	}
+
+	if field.Type() == timeType {
+		t, err := toTime(src)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch val := src.(type) {
+		case int64:
+			field.SetInt(val)
+		case float64:
+			field.SetInt(int64(val))
+		case bool:
+			if val {
+				field.SetInt(1)
+			} else {
+				field.SetInt(0)
+			}
+		default:
+			num, _ := strconv.ParseInt(toString(src), 10, 64)
+			field.SetInt(num)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch val := src.(type) {
+		case int64:
+			field.SetUint(uint64(val))
+		case float64:
+			field.SetUint(uint64(val))
+		case bool:
+			if val {
+				field.SetUint(1)
+			} else {
+				field.SetUint(0)
+			}
+		default:
+			num, _ := strconv.ParseUint(toString(src), 10, 64)
+			field.SetUint(num)
+		}
+	case reflect.String:
+		field.SetString(toString(src))
+	case reflect.Float32, reflect.Float64:
+		switch val := src.(type) {
+		case float64:
+			field.SetFloat(val)
+		case int64:
+			field.SetFloat(float64(val))
+		default:
+			num, err := strconv.ParseFloat(toString(src), 64)
+			if err != nil {
+				return nil
+			}
+			field.SetFloat(num)
+		}
+	case reflect.Bool:
+		switch val := src.(type) {
+		case bool:
+			field.SetBool(val)
+		case int64:
+			field.SetBool(val == 1)
+		default:
+			field.SetBool(toString(src) == "1")
+		}
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return ErrInvalidFieldTypes
+		}
+
+		switch val := src.(type) {
+		case []byte:
+			field.SetBytes(append([]byte(nil), val...))
+		default:
+			field.SetBytes([]byte(toString(src)))
+		}
+	default:
+		return ErrInvalidFieldTypes
+	}
+
+	return nil
+}
+
+// toString 转换为string，[]byte会被复制，因为驱动会复用其内存
+func toString(src interface{}) string {
+	switch val := src.(type) {
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	case time.Time:
+		return val.Format(timeLayouts[0])
+	default:
+		return fmt.Sprint(src)
+	}
+}
+
+func toTime(src interface{}) (t time.Time, err error) {
+	switch val := src.(type) {
+	case time.Time:
+		return val, nil
+	case int64:
+		return time.Unix(val, 0), nil
+	}
+
+	str := toString(src)
+	if str == "" || strings.HasPrefix(str, "0000-00-00") {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err = time.ParseInLocation(layout, str, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("orm: cannot convert %q to time.Time: %w", str, err)
+}
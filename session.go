@@ -0,0 +1,93 @@
+package orm
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+type sessionKey struct{}
+
+type sessionNameKey struct{}
+
+// session 读写会话，记录最后一次写入后读主库的截止时间(ms)
+type session struct {
+	until atomic.Int64
+}
+
+// WithSession 在ctx上开启读写会话，通过该ctx写入后，StickyMaster时间内的查询走主库
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// WithSessionKey 使用key标识读写会话，如用户ID，适用于跨请求保持写后读主库
+func WithSessionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, sessionNameKey{}, key)
+}
+
+// stick 写入成功后标记会话
+func (g *group) stick(ctx context.Context) {
+	if g.stickyMaster < 1 {
+		return
+	}
+
+	var (
+		current = time.Now().UnixMilli()
+		until   = current + g.stickyMaster
+	)
+
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.until.Store(until)
+	}
+
+	if key, ok := ctx.Value(sessionNameKey{}).(string); ok && key != "" {
+		g.sessions.Store(key, until)
+		g.sweep(current)
+	}
+}
+
+// sticky 会话是否处于读主库时间内
+func (g *group) sticky(ctx context.Context) bool {
+	if g.stickyMaster < 1 {
+		return false
+	}
+
+	current := time.Now().UnixMilli()
+
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok && s.until.Load() > current {
+		return true
+	}
+
+	key, ok := ctx.Value(sessionNameKey{}).(string)
+	if !ok || key == "" {
+		return false
+	}
+
+	until, ok := g.sessions.Load(key)
+	if !ok {
+		return false
+	}
+
+	if until.(int64) > current {
+		return true
+	}
+
+	g.sessions.Delete(key)
+	return false
+}
+
+// sweep 每个StickyMaster周期最多清理一次过期的会话key
+func (g *group) sweep(current int64) {
+	last := g.sweepTime.Load()
+	if current-last < g.stickyMaster || !g.sweepTime.CAS(last, current) {
+		return
+	}
+
+	g.sessions.Range(func(key, until interface{}) bool {
+		if until.(int64) <= current {
+			g.sessions.Delete(key)
+		}
+		return true
+	})
+}
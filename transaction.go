@@ -3,15 +3,38 @@ package orm
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strconv"
+	"time"
 
 	"github.com/grpc-boot/base"
 )
 
+var (
+	ErrInvalidSavepoint = errors.New(`mysql: invalid savepoint name, only letters, digits and underscores are allowed`)
+)
+
 type Transaction interface {
+	Querier
+
 	// Commit 提交事务
 	Commit() (err error)
 	// Rollback 回滚事务
 	Rollback() (err error)
+	// Savepoint 创建保存点，name仅允许字母、数字和下划线
+	Savepoint(name string) (err error)
+	// SavepointContext with context 创建保存点
+	SavepointContext(ctx context.Context, name string) (err error)
+	// RollbackTo 回滚到保存点
+	RollbackTo(name string) (err error)
+	// RollbackToContext with context 回滚到保存点
+	RollbackToContext(ctx context.Context, name string) (err error)
+	// Release 释放保存点
+	Release(name string) (err error)
+	// ReleaseContext with context 释放保存点
+	ReleaseContext(ctx context.Context, name string) (err error)
+	// Transaction 基于保存点的嵌套事务，返回nil释放保存点，返回错误或panic时回滚到保存点
+	Transaction(handler func(tx Transaction) error) (err error)
 	// Query 查询
 	Query(sqlStr string, args ...interface{}) (rows []map[string]string, err error)
 	// QueryContext with context 查询
@@ -20,9 +43,9 @@ type Transaction interface {
 	Exec(sqlStr string, args ...interface{}) (result sql.Result, err error)
 	// ExecContext with context 执行
 	ExecContext(ctx context.Context, sqlStr string, args ...interface{}) (result sql.Result, err error)
-	// InsertObj 插入对象
+	// InsertObj 插入对象，自增ID回写到primary字段
 	InsertObj(obj interface{}) (result sql.Result, err error)
-	// InsertObjContext with context 插入对象
+	// InsertObjContext with context 插入对象，自增ID回写到primary字段
 	InsertObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error)
 	// DeleteObj 删除对象
 	DeleteObj(obj interface{}) (result sql.Result, err error)
@@ -52,6 +75,14 @@ type Transaction interface {
 	Insert(table string, rows ...Row) (result sql.Result, err error)
 	// InsertContext with context 插入
 	InsertContext(ctx context.Context, table string, rows ...Row) (result sql.Result, err error)
+	// Upsert 插入，冲突时按option处理
+	Upsert(table string, option *UpsertOption, rows ...Row) (result sql.Result, err error)
+	// UpsertContext with context 插入，冲突时按option处理
+	UpsertContext(ctx context.Context, table string, option *UpsertOption, rows ...Row) (result sql.Result, err error)
+	// UpsertObj 插入对象，冲突时按option处理
+	UpsertObj(option *UpsertOption, obj interface{}) (result sql.Result, err error)
+	// UpsertObjContext with context 插入对象，冲突时按option处理
+	UpsertObjContext(ctx context.Context, option *UpsertOption, obj interface{}) (result sql.Result, err error)
 	// DeleteAll 删除
 	DeleteAll(table string, where Where) (result sql.Result, err error)
 	// DeleteAllContext with context 删除
@@ -60,14 +91,98 @@ type Transaction interface {
 	UpdateAll(table string, set Row, where Where) (result sql.Result, err error)
 	// UpdateAllContext with context  更新
 	UpdateAllContext(ctx context.Context, table string, set Row, where Where) (result sql.Result, err error)
+	// Increment 字段自增delta
+	Increment(table string, field string, delta interface{}, where Where) (result sql.Result, err error)
+	// IncrementContext with context 字段自增delta
+	IncrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error)
+	// Decrement 字段自减delta
+	Decrement(table string, field string, delta interface{}, where Where) (result sql.Result, err error)
+	// DecrementContext with context 字段自减delta
+	DecrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error)
 }
 
 type transaction struct {
-	tx *sql.Tx
+	tx           *sql.Tx
+	fillInsertId bool
+	savepoints   int
+	//开启事务时的ctx，非Context方法使用该ctx
+	ctx context.Context
+
+	group *group
+	pool  Pool
+	role  string
+	index int
+}
+
+func newTx(ctx context.Context, tx *sql.Tx) Transaction {
+	return &transaction{tx: tx, fillInsertId: true, ctx: ctx}
+}
+
+// baseContext 开启事务时的ctx
+func (t *transaction) baseContext() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
+}
+
+func (t *transaction) exec(ctx context.Context, sqlStr string, args ...interface{}) (result sql.Result, err error) {
+	reply, err := t.invoke(ctx, OpExec, sqlStr, args)
+	return reply.Result, wrapError(err)
+}
+
+func (t *transaction) query(ctx context.Context, sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
+	reply, err := t.invoke(ctx, OpQuery, sqlStr, args)
+	return reply.Rows, wrapError(err)
+}
+
+// invoke 绑定Group的事务经过Group的拦截器链执行语句
+func (t *transaction) invoke(ctx context.Context, op Operation, sqlStr string, args []interface{}) (reply *Reply, err error) {
+	stmt := &Statement{
+		Op:    op,
+		Sql:   sqlStr,
+		Args:  args,
+		Role:  t.role,
+		Index: t.index,
+		Pool:  t.pool,
+		Tx:    t,
+	}
+
+	if t.group == nil {
+		return t.do(ctx, stmt)
+	}
+	return t.group.invoke(ctx, stmt, t.do)
+}
+
+// do 拦截器链末端，在事务上执行语句
+func (t *transaction) do(ctx context.Context, stmt *Statement) (reply *Reply, err error) {
+	var (
+		start = time.Now()
+	)
+
+	reply = &Reply{}
+	switch stmt.Op {
+	case OpQuery:
+		reply.Rows, err = t.tx.QueryContext(ctx, stmt.Sql, stmt.Args...)
+	case OpExec:
+		reply.Result, err = t.tx.ExecContext(ctx, stmt.Sql, stmt.Args...)
+	case OpCommit:
+		err = t.tx.Commit()
+	case OpRollback:
+		err = t.tx.Rollback()
+	default:
+		return reply, ErrInvalidOperation
+	}
+
+	if t.group != nil {
+		t.group.record(t.role, t.index, start, err)
+		t.group.logStatement(ctx, t.role, t.index, stmt.Sql, stmt.Args, start, reply.Result, err)
+	}
+	return reply, err
 }
 
-func newTx(tx *sql.Tx) Transaction {
-	return &transaction{tx: tx}
+func (t *transaction) queryContext(ctx context.Context, useMaster bool, sqlStr string, args ...interface{}) (rows *sql.Rows, err error) {
+	return t.query(ctx, sqlStr, args...)
 }
 
 func (t *transaction) Query(sqlStr string, args ...interface{}) (rows []map[string]string, err error) {
@@ -75,7 +190,7 @@ func (t *transaction) Query(sqlStr string, args ...interface{}) (rows []map[stri
 		sqlRows *sql.Rows
 	)
 
-	sqlRows, err = t.tx.Query(sqlStr, args...)
+	sqlRows, err = t.query(t.baseContext(), sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -88,7 +203,7 @@ func (t *transaction) QueryContext(ctx context.Context, sqlStr string, args ...i
 		sqlRows *sql.Rows
 	)
 
-	sqlRows, err = t.tx.QueryContext(ctx, sqlStr, args...)
+	sqlRows, err = t.query(ctx, sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -97,11 +212,11 @@ func (t *transaction) QueryContext(ctx context.Context, sqlStr string, args ...i
 }
 
 func (t *transaction) Exec(sqlStr string, args ...interface{}) (result sql.Result, err error) {
-	return t.tx.Exec(sqlStr, args...)
+	return t.exec(t.baseContext(), sqlStr, args...)
 }
 
 func (t *transaction) ExecContext(ctx context.Context, sqlStr string, args ...interface{}) (result sql.Result, err error) {
-	return t.tx.ExecContext(ctx, sqlStr, args...)
+	return t.exec(ctx, sqlStr, args...)
 }
 
 func (t *transaction) InsertObj(obj interface{}) (result sql.Result, err error) {
@@ -113,7 +228,12 @@ func (t *transaction) InsertObj(obj interface{}) (result sql.Result, err error)
 		return nil, err
 	}
 
-	return t.tx.Exec(sqlStr, args...)
+	result, err = t.exec(t.baseContext(), sqlStr, args...)
+	if err != nil || !t.fillInsertId {
+		return
+	}
+
+	return result, fillInsertId(obj, result)
 }
 
 func (t *transaction) InsertObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error) {
@@ -125,7 +245,12 @@ func (t *transaction) InsertObjContext(ctx context.Context, obj interface{}) (re
 		return nil, err
 	}
 
-	return t.tx.ExecContext(ctx, sqlStr, args...)
+	result, err = t.exec(ctx, sqlStr, args...)
+	if err != nil || !t.fillInsertId {
+		return
+	}
+
+	return result, fillInsertId(obj, result)
 }
 
 func (t *transaction) DeleteObj(obj interface{}) (result sql.Result, err error) {
@@ -137,7 +262,7 @@ func (t *transaction) DeleteObj(obj interface{}) (result sql.Result, err error)
 		return nil, err
 	}
 
-	return t.tx.Exec(sqlStr, args...)
+	return t.exec(t.baseContext(), sqlStr, args...)
 }
 
 func (t *transaction) DeleteObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error) {
@@ -149,7 +274,7 @@ func (t *transaction) DeleteObjContext(ctx context.Context, obj interface{}) (re
 		return nil, err
 	}
 
-	return t.tx.ExecContext(ctx, sqlStr, args...)
+	return t.exec(ctx, sqlStr, args...)
 }
 
 func (t *transaction) UpdateObj(obj interface{}) (result sql.Result, err error) {
@@ -161,7 +286,7 @@ func (t *transaction) UpdateObj(obj interface{}) (result sql.Result, err error)
 		return nil, err
 	}
 
-	return t.tx.Exec(sqlStr, args...)
+	return t.exec(t.baseContext(), sqlStr, args...)
 }
 
 func (t *transaction) UpdateObjContext(ctx context.Context, obj interface{}) (result sql.Result, err error) {
@@ -173,7 +298,7 @@ func (t *transaction) UpdateObjContext(ctx context.Context, obj interface{}) (re
 		return nil, err
 	}
 
-	return t.tx.ExecContext(ctx, sqlStr, args...)
+	return t.exec(ctx, sqlStr, args...)
 }
 
 func (t *transaction) Find(query Query) (rows []map[string]string, err error) {
@@ -186,7 +311,7 @@ func (t *transaction) Find(query Query) (rows []map[string]string, err error) {
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = t.tx.Query(sqlStr, args...)
+	sqlRows, err = t.query(t.baseContext(), sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -204,7 +329,7 @@ func (t *transaction) FindContext(ctx context.Context, query Query) (rows []map[
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = t.tx.QueryContext(ctx, sqlStr, args...)
+	sqlRows, err = t.query(ctx, sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -222,7 +347,7 @@ func (t *transaction) FindAll(query Query, obj interface{}) (objList []interface
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = t.tx.Query(sqlStr, args...)
+	sqlRows, err = t.query(t.baseContext(), sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -240,7 +365,7 @@ func (t *transaction) FindAllContext(ctx context.Context, query Query, obj inter
 
 	defer base.ReleaseArgs(&args)
 
-	sqlRows, err = t.tx.QueryContext(ctx, sqlStr, args...)
+	sqlRows, err = t.query(ctx, sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -262,7 +387,7 @@ func (t *transaction) FindOne(table string, where Where) (row map[string]string,
 		query.Close()
 	}()
 
-	rows, err = t.tx.Query(sqlStr, args...)
+	rows, err = t.query(t.baseContext(), sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -292,7 +417,7 @@ func (t *transaction) FindOneContext(ctx context.Context, table string, where Wh
 		query.Close()
 	}()
 
-	rows, err = t.tx.QueryContext(ctx, sqlStr, args...)
+	rows, err = t.query(ctx, sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -321,7 +446,7 @@ func (t *transaction) FindOneObj(where Where, obj interface{}) (err error) {
 		return err
 	}
 
-	rows, err = t.tx.Query(sqlStr, args...)
+	rows, err = t.query(t.baseContext(), sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -342,7 +467,7 @@ func (t *transaction) FindOneObjContext(ctx context.Context, where Where, obj in
 		return err
 	}
 
-	rows, err = t.tx.QueryContext(ctx, sqlStr, args...)
+	rows, err = t.query(ctx, sqlStr, args...)
 	if err != nil {
 		return
 	}
@@ -357,7 +482,7 @@ func (t *transaction) Insert(table string, rows ...Row) (result sql.Result, err
 	)
 	defer base.ReleaseArgs(&args)
 
-	return t.tx.Exec(sqlStr, args...)
+	return t.exec(t.baseContext(), sqlStr, args...)
 }
 
 func (t *transaction) InsertContext(ctx context.Context, table string, rows ...Row) (result sql.Result, err error) {
@@ -367,7 +492,51 @@ func (t *transaction) InsertContext(ctx context.Context, table string, rows ...R
 	)
 	defer base.ReleaseArgs(&args)
 
-	return t.tx.ExecContext(ctx, sqlStr, args...)
+	return t.exec(ctx, sqlStr, args...)
+}
+
+func (t *transaction) Upsert(table string, option *UpsertOption, rows ...Row) (result sql.Result, err error) {
+	var (
+		args   = base.AcquireArgs()
+		sqlStr = SqlUpsert(&args, table, option, rows...)
+	)
+	defer base.ReleaseArgs(&args)
+
+	return t.exec(t.baseContext(), sqlStr, args...)
+}
+
+func (t *transaction) UpsertContext(ctx context.Context, table string, option *UpsertOption, rows ...Row) (result sql.Result, err error) {
+	var (
+		args   = base.AcquireArgs()
+		sqlStr = SqlUpsert(&args, table, option, rows...)
+	)
+	defer base.ReleaseArgs(&args)
+
+	return t.exec(ctx, sqlStr, args...)
+}
+
+func (t *transaction) UpsertObj(option *UpsertOption, obj interface{}) (result sql.Result, err error) {
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sqlStr, err := SqlUpsertObjs(&args, option, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.exec(t.baseContext(), sqlStr, args...)
+}
+
+func (t *transaction) UpsertObjContext(ctx context.Context, option *UpsertOption, obj interface{}) (result sql.Result, err error) {
+	args := base.AcquireArgs()
+	defer base.ReleaseArgs(&args)
+
+	sqlStr, err := SqlUpsertObjs(&args, option, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.exec(ctx, sqlStr, args...)
 }
 
 func (t *transaction) DeleteAll(table string, where Where) (result sql.Result, err error) {
@@ -377,7 +546,7 @@ func (t *transaction) DeleteAll(table string, where Where) (result sql.Result, e
 	)
 	defer base.ReleaseArgs(&args)
 
-	return t.tx.Exec(sqlStr, args...)
+	return t.exec(t.baseContext(), sqlStr, args...)
 }
 
 func (t *transaction) DeleteAllContext(ctx context.Context, table string, where Where) (result sql.Result, err error) {
@@ -387,7 +556,7 @@ func (t *transaction) DeleteAllContext(ctx context.Context, table string, where
 	)
 	defer base.ReleaseArgs(&args)
 
-	return t.tx.ExecContext(ctx, sqlStr, args...)
+	return t.exec(ctx, sqlStr, args...)
 }
 
 func (t *transaction) UpdateAll(table string, set Row, where Where) (result sql.Result, err error) {
@@ -397,7 +566,7 @@ func (t *transaction) UpdateAll(table string, set Row, where Where) (result sql.
 	)
 	defer base.ReleaseArgs(&args)
 
-	return t.tx.Exec(sqlStr, args...)
+	return t.exec(t.baseContext(), sqlStr, args...)
 }
 
 func (t *transaction) UpdateAllContext(ctx context.Context, table string, set Row, where Where) (result sql.Result, err error) {
@@ -407,13 +576,107 @@ func (t *transaction) UpdateAllContext(ctx context.Context, table string, set Ro
 	)
 	defer base.ReleaseArgs(&args)
 
-	return t.tx.ExecContext(ctx, sqlStr, args...)
+	return t.exec(ctx, sqlStr, args...)
+}
+
+func (t *transaction) Increment(table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return t.UpdateAll(table, Row{field: Expr(field+"+?", delta)}, where)
+}
+
+func (t *transaction) IncrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return t.UpdateAllContext(ctx, table, Row{field: Expr(field+"+?", delta)}, where)
+}
+
+func (t *transaction) Decrement(table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return t.UpdateAll(table, Row{field: Expr(field+"-?", delta)}, where)
+}
+
+func (t *transaction) DecrementContext(ctx context.Context, table string, field string, delta interface{}, where Where) (result sql.Result, err error) {
+	return t.UpdateAllContext(ctx, table, Row{field: Expr(field+"-?", delta)}, where)
 }
 
 func (t *transaction) Commit() (err error) {
-	return t.tx.Commit()
+	_, err = t.invoke(t.baseContext(), OpCommit, `COMMIT`, nil)
+	return wrapError(err)
 }
 
 func (t *transaction) Rollback() (err error) {
-	return t.tx.Rollback()
+	_, err = t.invoke(t.baseContext(), OpRollback, `ROLLBACK`, nil)
+	return wrapError(err)
+}
+
+func (t *transaction) Savepoint(name string) (err error) {
+	return t.SavepointContext(t.baseContext(), name)
+}
+
+func (t *transaction) SavepointContext(ctx context.Context, name string) (err error) {
+	if !isIdentifier(name) {
+		return ErrInvalidSavepoint
+	}
+
+	_, err = t.exec(ctx, "SAVEPOINT `"+name+"`")
+	return
+}
+
+func (t *transaction) RollbackTo(name string) (err error) {
+	return t.RollbackToContext(t.baseContext(), name)
+}
+
+func (t *transaction) RollbackToContext(ctx context.Context, name string) (err error) {
+	if !isIdentifier(name) {
+		return ErrInvalidSavepoint
+	}
+
+	_, err = t.exec(ctx, "ROLLBACK TO SAVEPOINT `"+name+"`")
+	return
+}
+
+func (t *transaction) Release(name string) (err error) {
+	return t.ReleaseContext(t.baseContext(), name)
+}
+
+func (t *transaction) ReleaseContext(ctx context.Context, name string) (err error) {
+	if !isIdentifier(name) {
+		return ErrInvalidSavepoint
+	}
+
+	_, err = t.exec(ctx, "RELEASE SAVEPOINT `"+name+"`")
+	return
+}
+
+func (t *transaction) Transaction(handler func(tx Transaction) error) (err error) {
+	t.savepoints++
+	name := "orm_sp_" + strconv.Itoa(t.savepoints)
+
+	if err = t.Savepoint(name); err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			_ = t.RollbackTo(name)
+			panic(r)
+		}
+	}()
+
+	if err = handler(t); err != nil {
+		_ = t.RollbackTo(name)
+		return err
+	}
+
+	return t.Release(name)
+}
+
+// isIdentifier 是否为仅包含字母、数字和下划线的标识符
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,151 @@
+package orm
+
+import (
+	"strings"
+)
+
+const (
+	onDuplicateKeyUpdate = iota
+	insertIgnore
+	replace
+)
+
+type upsertItem struct {
+	field string
+	value interface{}
+}
+
+// UpsertOption 插入冲突处理方式
+type UpsertOption struct {
+	mode  int
+	items []upsertItem
+}
+
+// OnDuplicateKeyUpdate INSERT ... ON DUPLICATE KEY UPDATE，未指定更新字段时更新所有插入的非主键字段
+func OnDuplicateKeyUpdate() *UpsertOption {
+	return &UpsertOption{mode: onDuplicateKeyUpdate}
+}
+
+// InsertIgnore INSERT IGNORE INTO
+func InsertIgnore() *UpsertOption {
+	return &UpsertOption{mode: insertIgnore}
+}
+
+// ReplaceInto REPLACE INTO
+func ReplaceInto() *UpsertOption {
+	return &UpsertOption{mode: replace}
+}
+
+// Values 更新为插入的值，生成field=VALUES(field)
+func (uo *UpsertOption) Values(fields ...string) *UpsertOption {
+	for _, field := range fields {
+		uo.items = append(uo.items, upsertItem{
+			field: field,
+			value: Expr("VALUES(" + field + ")"),
+		})
+	}
+	return uo
+}
+
+// Set 更新为指定值，生成field=?，value为Expression时原样写入
+func (uo *UpsertOption) Set(field string, value interface{}) *UpsertOption {
+	uo.items = append(uo.items, upsertItem{
+		field: field,
+		value: value,
+	})
+	return uo
+}
+
+// Expr 更新为表达式，生成field=expr，如：Expr("`count`", "`count`+?", 1)
+func (uo *UpsertOption) Expr(field string, expr string, args ...interface{}) *UpsertOption {
+	uo.items = append(uo.items, upsertItem{
+		field: field,
+		value: Expr(expr, args...),
+	})
+	return uo
+}
+
+func (uo *UpsertOption) verb() string {
+	if uo == nil {
+		return insertInto
+	}
+
+	switch uo.mode {
+	case insertIgnore:
+		return insertIgnoreInto
+	case replace:
+		return replaceInto
+	}
+	return insertInto
+}
+
+// sql 生成ON DUPLICATE KEY UPDATE子句，defaultFields为未指定更新字段时的默认更新字段
+func (uo *UpsertOption) sql(args *[]interface{}, defaultFields []string) string {
+	if uo != nil && uo.mode != onDuplicateKeyUpdate {
+		return ""
+	}
+
+	var (
+		sqlBuffer strings.Builder
+		items     []upsertItem
+	)
+
+	if uo != nil {
+		items = uo.items
+	}
+
+	if len(items) < 1 {
+		items = (&UpsertOption{}).Values(defaultFields...).items
+	}
+
+	if len(items) < 1 {
+		return ""
+	}
+
+	sqlBuffer.WriteString(" ON DUPLICATE KEY UPDATE ")
+	for index, item := range items {
+		if index > 0 {
+			sqlBuffer.WriteByte(',')
+		}
+
+		sqlBuffer.WriteString(item.field)
+		sqlBuffer.WriteByte('=')
+		sqlBuffer.WriteString(placeholder(args, item.value))
+	}
+
+	return sqlBuffer.String()
+}
+
+// SqlUpsert 生成upsert sql，option为nil时为ON DUPLICATE KEY UPDATE所有插入字段
+func SqlUpsert(args *[]interface{}, table string, option *UpsertOption, rows ...Row) (sql string) {
+	if len(rows) < 1 {
+		return ""
+	}
+
+	return SqlUpsertOrdered(args, table, option, orderedRows(rows)...)
+}
+
+// SqlUpsertOrdered 生成upsert sql，字段按第一行的顺序生成
+func SqlUpsertOrdered(args *[]interface{}, table string, option *UpsertOption, rows ...OrderedRow) (sql string) {
+	sql = sqlInsert(args, option.verb(), table, rows)
+	if sql == "" {
+		return
+	}
+
+	fields := make([]string, 0, len(rows[0]))
+	for _, pair := range rows[0] {
+		fields = append(fields, pair.Field)
+	}
+
+	return sql + option.sql(args, fields)
+}
+
+// SqlUpsertObjs 生成对象upsert sql，option为nil时为ON DUPLICATE KEY UPDATE所有插入的非主键字段
+func SqlUpsertObjs(args *[]interface{}, option *UpsertOption, rows interface{}) (sql string, err error) {
+	sql, fields, err := sqlInsertObjs(args, option.verb(), rows)
+	if err != nil {
+		return "", err
+	}
+
+	return sql + option.sql(args, fields), nil
+}
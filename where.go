@@ -66,16 +66,22 @@ func (w *where) Sql(args *[]interface{}) (sql string) {
 	}
 
 	var (
-		buf strings.Builder
+		buf          strings.Builder
+		hasCondition bool
 	)
 
-	for index, wc := range w.items {
+	for _, wc := range w.items {
+		if wc.condition == nil {
+			continue
+		}
+
 		sqlStr := wc.condition.Sql(args)
 		if sqlStr == "" {
 			continue
 		}
 
-		if index == 0 {
+		if !hasCondition {
+			hasCondition = true
 			buf.WriteString(` WHERE `)
 		} else {
 			buf.WriteByte(' ')